@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/SolarDomo/Cobweb/example/douban"
+	"github.com/SolarDomo/Cobweb/internal/cobweb"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+在一台机器上以多进程的方式运行 cobweb 集群
+
+	go run ./cmd/cluster -role coordinator -addr 127.0.0.1:9090
+	go run ./cmd/cluster -role worker -coordinator http://127.0.0.1:9090
+	go run ./cmd/cluster -role worker -coordinator http://127.0.0.1:9090
+*/
+func main() {
+	role := flag.String("role", "coordinator", "coordinator or worker")
+	addr := flag.String("addr", "127.0.0.1:9090", "address coordinator listens on")
+	coordinatorURL := flag.String("coordinator", "http://127.0.0.1:9090", "url of coordinator, used by worker")
+	redisAddr := flag.String("redis", "", "redis address of coordinator's frontier, in memory if empty")
+	noProxy := flag.Bool("noproxy", false, "worker downloads without proxy")
+	flag.Parse()
+
+	// items are sent from workers to coordinator by gob
+	gob.Register(douban.DoubanItem{})
+
+	switch *role {
+	case "coordinator":
+		runCoordinator(*addr, *redisAddr)
+	case "worker":
+		runWorker(*coordinatorURL, *noProxy)
+	default:
+		fmt.Println("unknown role", *role)
+		os.Exit(1)
+	}
+}
+
+func runCoordinator(addr, redisAddr string) {
+	frontier := cobweb.NewMemoryFrontier()
+	if redisAddr != "" {
+		frontier = cobweb.NewRedisFrontier(redisAddr, cobweb.DefaultRedisFrontierKeyPrefix)
+	}
+
+	c := cobweb.NewCoordinator(frontier, cobweb.DefaultClusterLeaseTTL)
+	go func() {
+		if err := c.ListenAndServe(addr); err != nil {
+			logrus.WithField("Error", err).Fatal("coordinator serve failed")
+		}
+	}()
+
+	startTime := time.Now()
+	t := c.AcceptRule(&douban.DoubanRule{})
+	t.Wait()
+	fmt.Println("耗时: ", time.Since(startTime))
+	c.Stop()
+}
+
+func runWorker(coordinatorURL string, noProxy bool) {
+	w := cobweb.NewWorker(coordinatorURL, func(frontier cobweb.Frontier) *cobweb.Executor {
+		if noProxy {
+			return cobweb.NewExecutor(
+				cobweb.NewMemoryProxyStorage(),
+				frontier,
+				&cobweb.NoProxyFastHTTPDownloaderFactory{},
+				1,
+				20,
+				10,
+				time.Second*3,
+			)
+		}
+
+		storage, err := cobweb.NewDefaultDBProxyStorage()
+		if err != nil {
+			logrus.WithField("Error", err).Fatal("open proxy storage failed")
+		}
+		return cobweb.NewDefaultExecutorWithFrontier(storage, frontier)
+	})
+	if err := w.RegisterRule(&douban.DoubanRule{}); err != nil {
+		logrus.WithField("Error", err).Fatal("register rule failed")
+	}
+	logrus.WithField("WorkerID", w.ID()).Info("worker started")
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+	w.Stop()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SolarDomo/Cobweb/internal/cobweb"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+运行 YAML 或 JSON 描述的规则, 见 cobweb.DeclarativeRule
+
+	go run ./cmd/declarative -noproxy rule.yaml
+*/
+func main() {
+	noProxy := flag.Bool("noproxy", false, "download without proxy")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("usage: declarative [-noproxy] rule.yaml")
+		os.Exit(1)
+	}
+
+	rule, err := cobweb.LoadDeclarativeRule(flag.Arg(0))
+	if err != nil {
+		logrus.WithField("Error", err).Fatal("load rule failed")
+	}
+
+	var e *cobweb.Executor
+	if *noProxy {
+		e = cobweb.NewExecutor(
+			cobweb.NewMemoryProxyStorage(),
+			cobweb.NewMemoryFrontier(),
+			&cobweb.NoProxyFastHTTPDownloaderFactory{},
+			1,
+			20,
+			10,
+			time.Second*3,
+		)
+	} else {
+		storage, err := cobweb.NewDefaultDBProxyStorage()
+		if err != nil {
+			logrus.WithField("Error", err).Fatal("open proxy storage failed")
+		}
+		e = cobweb.NewDefaultExecutor(storage)
+	}
+
+	startTime := time.Now()
+	t := e.AcceptRule(rule)
+	if t == nil {
+		e.Stop()
+		os.Exit(1)
+	}
+	t.Wait()
+	fmt.Println("耗时: ", time.Since(startTime))
+	e.Stop()
+}
@@ -15,13 +15,17 @@ func main() {
 	//logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetLevel(logrus.DebugLevel)
 	startTime := time.Now()
-	e := cobweb.NewDefaultExecutor()
+	storage, err := cobweb.NewDefaultDBProxyStorage()
+	if err != nil {
+		logrus.WithField("Error", err).Fatal("open proxy storage failed")
+	}
+	e := cobweb.NewDefaultExecutor(storage)
 	t := e.AcceptRule(&douban.DoubanRule{})
 	t.Wait()
 	fmt.Println("耗时: ", time.Since(startTime))
 	e.Stop()
-	//e := cobweb.NewDefaultExecutor()
-	//pool := cobweb.NewProxyPool(e, time.Second*30, 200)
+	//e := cobweb.NewDefaultExecutor(storage)
+	//pool := cobweb.NewProxyPool(e, storage, time.Second*30, 200)
 	//pool.Start()
 	//time.Sleep(time.Hour)
 	//pool.Stop()
@@ -0,0 +1,18 @@
+package declarative
+
+import (
+	"testing"
+
+	"github.com/SolarDomo/Cobweb/internal/cobweb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeclarativeDouban(t *testing.T) {
+	rule, err := cobweb.LoadDeclarativeRule("douban.yaml")
+	assert.Nil(t, err)
+
+	suit := cobweb.NewTestSuits(t)
+	links, items := suit.WithFile(rule.InitParse, "../douban/list.html", cobweb.H{})
+	assert.Len(t, items, 25)
+	assert.Len(t, links, 26)
+}
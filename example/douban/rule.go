@@ -2,7 +2,6 @@ package douban
 
 import (
 	"fmt"
-	"strings"
 
 	"github.com/SolarDomo/Cobweb/internal/cobweb"
 )
@@ -10,10 +9,9 @@ import (
 /*
 使用 Cobweb 爬取豆瓣电影 Top250 榜单
 在 instance 文件夹下建立文件夹 douban
-为每部电影 建立格式为
-	[排名].[电影名]
-文件夹
-文件中保存电影封面 cover.jpg
+电影封面保存到 media 文件夹, 以
+	[排名].[年份].[电影名].cover.jpg
+为名
 电影详细信息保存到 info.json
 */
 
@@ -27,6 +25,7 @@ type DoubanItem struct {
 	Kinds     []string
 	Runtime   string
 	IMDbLink  string
+	Cover     cobweb.MediaRef
 }
 
 type DoubanRule struct {
@@ -38,24 +37,33 @@ func (r *DoubanRule) Pipelines() []cobweb.Pipeline {
 	}
 }
 
-func (r *DoubanRule) InitLinks() []string {
-	links := make([]string, 0, 10)
-	for i := 0; i < 10; i++ {
-		links = append(links, fmt.Sprintf("https://movie.douban.com/top250?start=%d&filter=", i*25))
+// callbacks used by cluster workers
+func (r *DoubanRule) Callbacks() []cobweb.OnParseCallback {
+	return []cobweb.OnParseCallback{
+		r.scrapeDetailPage,
 	}
-	return links
+}
+
+// re-crawl only downloads pages changed since last run
+func (r *DoubanRule) HTTPCache() cobweb.HTTPCacheConfig {
+	return cobweb.HTTPCacheConfig{Policy: cobweb.CachePolicyRespectCacheControl}
+}
+
+func (r *DoubanRule) InitLinks() []string {
+	return []string{"https://movie.douban.com/top250?start=0&filter="}
 }
 
 func (r *DoubanRule) InitParse(ctx *cobweb.Context) {
 	ctx.HTML("#content > div > div.article > ol > li", func(element *cobweb.HTMLElement) {
-		rank := element.ChildText("div.pic em")
-		detailLink := element.ChildAttr("div.pic a", "href")
-		if strings.TrimSpace(rank) != "65" {
+		rank := element.ChildCleanText("div.pic em")
+		detailLink := element.ChildAbsAttr("div.pic a", "href")
+		if rank != "65" {
 			ctx.Follow(detailLink, r.scrapeDetailPage, cobweb.H{
 				"Rank": rank,
 			})
 		}
 	})
+	ctx.PaginateURL("https://movie.douban.com/top250?start={n*25}&filter=", r.InitParse, 10)
 }
 
 func (r *DoubanRule) scrapeDetailPage(ctx *cobweb.Context) {
@@ -71,6 +79,7 @@ func (r *DoubanRule) scrapeDetailPage(ctx *cobweb.Context) {
 
 		element.ForEach("div#info", func(element *cobweb.HTMLElement) {
 			directors := element.ChildrenTexts("span > a[rel*=directedBy]")
+			cover := ctx.SaveMedia(picLink, fmt.Sprintf("%v.%v.%v.cover.jpg", rank, year, title))
 			ctx.Item(DoubanItem{
 				Title:     title,
 				Year:      year,
@@ -81,8 +90,8 @@ func (r *DoubanRule) scrapeDetailPage(ctx *cobweb.Context) {
 				Kinds:     kinds,
 				Runtime:   runtime,
 				IMDbLink:  imdbLink,
+				Cover:     cover,
 			})
-			ctx.SaveResource(picLink, fmt.Sprintf("%v.%v.%v.cover.jpg", rank, year, title))
 		})
 	})
 }
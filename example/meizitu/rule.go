@@ -11,6 +11,14 @@ import (
 type MeizituRule struct {
 }
 
+// images are browsable by title under media/files
+func (r *MeizituRule) MediaStore() cobweb.MediaStoreConfig {
+	return cobweb.MediaStoreConfig{
+		Dir:      "media",
+		Symlinks: true,
+	}
+}
+
 func (r *MeizituRule) InitLinks() []string {
 	links := make([]string, 0)
 	for i := 0; i < 1; i++ {
@@ -33,13 +41,10 @@ func (r *MeizituRule) parseDetailPage(ctx *cobweb.Context) {
 		title := element.ChildText("#main > div > div.mainl > div.post > div.title > h1")
 		imgLinks := element.ChildrenAttrs("#main > div > div.mainl > div.post > div.article_content.text p img", "src")
 		for index, link := range imgLinks {
-			ctx.SaveResource(link, fmt.Sprintf("%v/%v.%v", title, index, getExtention(link)))
-		}
-		nextPage := element.MayChildAttr("#nextpage", "href")
-		if nextPage != "" {
-			ctx.Follow(nextPage, r.parseDetailPage)
+			ctx.SaveMedia(link, fmt.Sprintf("%v/%v.%v", title, index, getExtention(link)))
 		}
 	})
+	ctx.Paginate("#nextpage", r.parseDetailPage, 0)
 }
 
 func getExtention(urlstring string) string {
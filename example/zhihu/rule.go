@@ -1,11 +1,32 @@
 package zhihu
 
 import (
-	"fmt"
-
 	"github.com/SolarDomo/Cobweb/internal/cobweb"
 )
 
+// 热榜数据在 js-initialData 的 JSON 中, 页面内容由 js 渲染
+type HotItem struct {
+	Title   string
+	Excerpt string
+	Heat    string
+	Link    string
+}
+
+type hotListData struct {
+	InitialState struct {
+		Topstory struct {
+			HotList []struct {
+				Target struct {
+					TitleArea   struct{ Text string } `json:"titleArea"`
+					ExcerptArea struct{ Text string } `json:"excerptArea"`
+					MetricsArea struct{ Text string } `json:"metricsArea"`
+					Link        struct{ URL string }  `json:"link"`
+				} `json:"target"`
+			} `json:"hotList"`
+		} `json:"topstory"`
+	} `json:"initialState"`
+}
+
 type zhihuRule struct {
 }
 
@@ -16,8 +37,14 @@ func (r *zhihuRule) InitLinks() []string {
 }
 
 func (r *zhihuRule) InitParse(ctx *cobweb.Context) {
-	ctx.HTML("", func(element *cobweb.HTMLElement) {
-		titles := element.ChildrenTexts("#TopstoryContent > div > div > div.HotList-list > section > div.HotItem-content > a > h2")
-		fmt.Println(titles)
-	})
+	data := &hotListData{}
+	ctx.ScriptJSON("#js-initialData", data)
+	for _, hot := range data.InitialState.Topstory.HotList {
+		ctx.Item(&HotItem{
+			Title:   hot.Target.TitleArea.Text,
+			Excerpt: hot.Target.ExcerptArea.Text,
+			Heat:    hot.Target.MetricsArea.Text,
+			Link:    hot.Target.Link.URL,
+		})
+	}
 }
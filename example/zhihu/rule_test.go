@@ -4,10 +4,13 @@ import (
 	"testing"
 
 	"github.com/SolarDomo/Cobweb/internal/cobweb"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestZhihuRule(t *testing.T) {
 	r := &zhihuRule{}
 	suit := cobweb.NewTestSuits(t)
-	suit.WithFile(r.InitParse, "hot.html", cobweb.H{})
+	_, items := suit.WithFile(r.InitParse, "hot.html", cobweb.H{})
+	assert.Len(t, items, 50)
+	assert.Equal(t, "https://www.zhihu.com/question/410328126", items[0].(*HotItem).Link)
 }
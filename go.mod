@@ -4,12 +4,22 @@ go 1.14
 
 require (
 	github.com/PuerkitoBio/goquery v1.5.1
+	github.com/alicebob/miniredis/v2 v2.14.3
+	github.com/andybalholm/cascadia v1.1.0
+	github.com/antchfx/htmlquery v1.2.4
+	github.com/antchfx/xpath v1.3.8
 	github.com/deckarep/golang-set v1.7.1
 	github.com/go-sql-driver/mysql v1.5.0
+	github.com/gomodule/redigo v1.8.9
 	github.com/jinzhu/gorm v1.9.15
+	github.com/robertkrimen/otto v0.0.0-20211024170158-b87d35c0b86f
 	github.com/robfig/cron/v3 v3.0.1
 	github.com/rs/xid v1.2.1
 	github.com/sirupsen/logrus v1.6.0
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.7.0
 	github.com/valyala/fasthttp v1.34.0
+	golang.org/x/image v0.0.0-20220302094943-723b81ca9867
+	golang.org/x/net v0.0.0-20220225172249-27dd8689420f
+	golang.org/x/text v0.3.7
+	gopkg.in/yaml.v3 v3.0.1
 )
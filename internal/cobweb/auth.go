@@ -0,0 +1,295 @@
+package cobweb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultAuthTimeout      = time.Second * 20
+	DefaultAuthMaxRedirects = 10
+)
+
+// AuthRule logs in before InitLinks are scheduled
+// cookies set during Authenticate are saved to task's cookie jar,
+// so the session is shared by every downloader of task,
+// task keeps cookies in memory if rule doesn't implement CookieJarRule,
+// CookieJarDisabled is rejected
+type AuthRule interface {
+	Authenticate(session *AuthSession) error
+}
+
+// AuthRefreshRule refreshes expired session, see AuthSession.ExpiresIn
+// Authenticate is called again if it returns error
+type AuthRefreshRule interface {
+	RefreshAuth(session *AuthSession) error
+}
+
+// LoggedOutDetectorsRule finds responses of logged out session,
+// task authenticates again and the command is downloaded again
+type LoggedOutDetectorsRule interface {
+	LoggedOutDetectors() []BanDetector
+}
+
+// AuthResponse is response of request sent by AuthSession
+type AuthResponse struct {
+	StatusCode int
+	URL        string
+	Header     map[string]string
+	Body       []byte
+
+	doc *goquery.Document
+}
+
+func (r *AuthResponse) Doc() (*goquery.Document, error) {
+	if r.doc == nil {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(r.Body))
+		if err != nil {
+			return nil, err
+		}
+		r.doc = doc
+	}
+	return r.doc, nil
+}
+
+// value of attr of first element found by selector, e.g. csrf token in login form
+func (r *AuthResponse) Attr(selector, attr string) (string, error) {
+	doc, err := r.Doc()
+	if err != nil {
+		return "", err
+	}
+	val, exists := doc.Find(selector).First().Attr(attr)
+	if !exists {
+		return "", fmt.Errorf("attr %s of %s not found", attr, selector)
+	}
+	return val, nil
+}
+
+func (r *AuthResponse) JSON(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// AuthSession sends login requests with cookies of task
+type AuthSession struct {
+	task   *Task
+	client *fasthttp.Client
+
+	headers   map[string]string
+	expiresAt time.Time
+}
+
+func newAuthSession(task *Task) *AuthSession {
+	return &AuthSession{
+		task:    task,
+		client:  &fasthttp.Client{},
+		headers: make(map[string]string),
+	}
+}
+
+// header is set to every request of task, e.g. Authorization
+func (s *AuthSession) SetHeader(key, val string) {
+	s.headers[key] = val
+}
+
+// session is refreshed before the first download after d
+func (s *AuthSession) ExpiresIn(d time.Duration) {
+	s.expiresAt = time.Now().Add(d)
+}
+
+func (s *AuthSession) Get(link string) (*AuthResponse, error) {
+	return s.Do(fasthttp.MethodGet, link, "", nil)
+}
+
+func (s *AuthSession) PostForm(link string, form map[string]string) (*AuthResponse, error) {
+	values := url.Values{}
+	for key, val := range form {
+		values.Set(key, val)
+	}
+	return s.Do(fasthttp.MethodPost, link, "application/x-www-form-urlencoded", []byte(values.Encode()))
+}
+
+func (s *AuthSession) PostJSON(link string, data interface{}) (*AuthResponse, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return s.Do(fasthttp.MethodPost, link, "application/json", body)
+}
+
+// send request and follow redirects, cookies of every response are saved
+func (s *AuthSession) Do(method, link, contentType string, body []byte) (*AuthResponse, error) {
+	req := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(req)
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI(link)
+	if contentType != "" {
+		req.Header.SetContentType(contentType)
+	}
+	req.SetBody(body)
+
+	for redirects := 0; ; redirects++ {
+		req.Header.SetUserAgent(DefaultUserAgent)
+		s.applyTo(req)
+		if s.task.cookieJar != nil {
+			s.task.cookieJar.apply("", req)
+		}
+
+		if err := s.client.DoTimeout(req, resp, DefaultAuthTimeout); err != nil {
+			return nil, err
+		}
+		if s.task.cookieJar != nil {
+			s.task.cookieJar.update("", req.URI(), resp)
+		}
+
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) || len(location) == 0 {
+			break
+		}
+		if redirects >= DefaultAuthMaxRedirects {
+			return nil, fmt.Errorf("too many redirects of %s", link)
+		}
+
+		uri := fasthttp.AcquireURI()
+		req.URI().CopyTo(uri)
+		uri.UpdateBytes(location)
+		if code := resp.StatusCode(); code == fasthttp.StatusTemporaryRedirect || code == fasthttp.StatusPermanentRedirect {
+			// 307 and 308 keep method and body
+			req.SetRequestURIBytes(uri.FullURI())
+		} else {
+			req.Reset()
+			req.SetRequestURIBytes(uri.FullURI())
+		}
+		fasthttp.ReleaseURI(uri)
+	}
+
+	authResp := &AuthResponse{
+		StatusCode: resp.StatusCode(),
+		URL:        req.URI().String(),
+		Header:     make(map[string]string),
+		Body:       append([]byte(nil), resp.Body()...),
+	}
+	resp.Header.VisitAll(func(key, value []byte) {
+		authResp.Header[string(key)] = string(value)
+	})
+	return authResp, nil
+}
+
+func (s *AuthSession) applyTo(req *fasthttp.Request) {
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+}
+
+func (s *AuthSession) expired(nt time.Time) bool {
+	return !s.expiresAt.IsZero() && !s.expiresAt.After(nt)
+}
+
+// taskAuth runs AuthRule of task, only one login runs at the same time
+type taskAuth struct {
+	task      *Task
+	rule      AuthRule
+	detectors []BanDetector
+
+	locker  sync.RWMutex
+	session *AuthSession
+	// increased by every successful login
+	generation int
+}
+
+func newTaskAuth(task *Task, rule AuthRule) *taskAuth {
+	a := &taskAuth{
+		task: task,
+		rule: rule,
+	}
+	if detectorsRule, ok := rule.(LoggedOutDetectorsRule); ok {
+		a.detectors = detectorsRule.LoggedOutDetectors()
+	}
+	return a
+}
+
+// login if session doesn't exist or is expired
+func (a *taskAuth) ensure() error {
+	a.locker.RLock()
+	session, generation := a.session, a.generation
+	a.locker.RUnlock()
+	if session != nil && !session.expired(time.Now()) {
+		return nil
+	}
+	return a.reauthenticate(generation)
+}
+
+// login again if nobody did it after generation
+func (a *taskAuth) reauthenticate(generation int) error {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+	if a.generation != generation && a.session != nil && !a.session.expired(time.Now()) {
+		return nil
+	}
+
+	var err error
+	refreshRule, ok := a.rule.(AuthRefreshRule)
+	if ok && a.session != nil {
+		session := a.copySession()
+		if err = refreshRule.RefreshAuth(session); err == nil {
+			a.setSession(session)
+			return nil
+		}
+		logrus.WithFields(a.task.logrusFields()).WithField("Error", err).Warn("refresh auth failed")
+	}
+
+	session := newAuthSession(a.task)
+	if err = a.rule.Authenticate(session); err != nil {
+		logrus.WithFields(a.task.logrusFields()).WithField("Error", err).Error("authenticate failed")
+		return err
+	}
+	a.setSession(session)
+	return nil
+}
+
+// caller holds locker
+func (a *taskAuth) copySession() *AuthSession {
+	session := newAuthSession(a.task)
+	for key, val := range a.session.headers {
+		session.headers[key] = val
+	}
+	return session
+}
+
+// caller holds locker
+func (a *taskAuth) setSession(session *AuthSession) {
+	a.session = session
+	a.generation++
+	logrus.WithFields(a.task.logrusFields()).WithField("AuthGeneration", a.generation).Info("authenticated")
+}
+
+// set headers of session to request of cmd, return generation of session
+func (a *taskAuth) apply(cmd *command) int {
+	if err := a.ensure(); err != nil {
+		return -1
+	}
+	a.locker.RLock()
+	defer a.locker.RUnlock()
+	a.session.applyTo(cmd.request())
+	return a.generation
+}
+
+func (a *taskAuth) isLoggedOut(cmd *command) bool {
+	for _, detector := range a.detectors {
+		if reason := detector.DetectBan(cmd.request(), cmd.response()); reason != "" {
+			logrus.WithFields(cmd.logrusFields()).WithField("LoggedOutReason", reason).Warn("logged out response")
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package cobweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type authTestRule struct {
+	frontierTestRule
+	server *httptest.Server
+	logins int
+}
+
+func (r *authTestRule) Authenticate(session *AuthSession) error {
+	resp, err := session.Get(r.server.URL + "/login")
+	if err != nil {
+		return err
+	}
+	csrf, err := resp.Attr("input[name=csrf]", "value")
+	if err != nil {
+		return err
+	}
+	resp, err = session.PostForm(r.server.URL+"/login", map[string]string{"csrf": csrf})
+	if err != nil {
+		return err
+	}
+	if resp.URL != r.server.URL+"/home" {
+		return fmt.Errorf("login failed, %s", resp.URL)
+	}
+	r.logins++
+	session.SetHeader("X-Token", fmt.Sprint(r.logins))
+	return nil
+}
+
+func (r *authTestRule) LoggedOutDetectors() []BanDetector {
+	return []BanDetector{&RedirectBanDetector{Pattern: regexp.MustCompile("/login")}}
+}
+
+func TestTaskAuth(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "csrf", Value: "c1", Path: "/"})
+			fmt.Fprint(w, `<form><input name="csrf" value="c1"></form>`)
+			return
+		}
+		cookie, err := r.Cookie("csrf")
+		if err != nil || cookie.Value != r.FormValue("csrf") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1", Path: "/"})
+		http.Redirect(w, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rule := &authTestRule{server: server}
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	// login cookies are kept in memory without CookieJarRule
+	assert.NotNil(t, task.cookieJar)
+	assert.Equal(t, "", task.cookieJar.filePath)
+	assert.Nil(t, task.authenticate())
+	assert.Nil(t, task.authenticate())
+	assert.Equal(t, 1, rule.logins)
+
+	b := newCommandBuilder(task)
+	b.Link(server.URL + "/data")
+	cmd := b.build()
+	cmd.downloadStart(nil)
+	assert.Equal(t, "s1", string(cmd.request().Header.Cookie("sid")))
+	assert.Equal(t, "1", string(cmd.request().Header.Peek("X-Token")))
+
+	cmd.response().SetStatusCode(302)
+	cmd.response().Header.Set("Location", "/login")
+	assert.True(t, task.auth.isLoggedOut(cmd))
+	generation := cmd.authGeneration
+	assert.Nil(t, task.auth.reauthenticate(generation))
+	// another logged out response of the same session doesn't login again
+	assert.Nil(t, task.auth.reauthenticate(generation))
+	assert.Equal(t, 2, rule.logins)
+
+	cmd.downloadStart(nil)
+	assert.Equal(t, "2", string(cmd.request().Header.Peek("X-Token")))
+}
+
+type authNoJarTestRule struct {
+	authTestRule
+}
+
+func (r *authNoJarTestRule) CookieJarMode() CookieJarMode {
+	return CookieJarDisabled
+}
+
+func TestAuthRuleWithoutCookieJar(t *testing.T) {
+	task := newTaskFromRule(&authNoJarTestRule{}, NewMemoryFrontier())
+	assert.NotNil(t, task.ruleErr)
+}
+
+func TestAuthSessionRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusPermanentRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.FormValue("user"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	task := newTaskFromRule(&authTestRule{server: server}, NewMemoryFrontier())
+	resp, err := newAuthSession(task).PostForm(server.URL+"/old", map[string]string{"user": "u1"})
+	assert.Nil(t, err)
+	assert.Equal(t, server.URL+"/new", resp.URL)
+	assert.Equal(t, "POST u1", string(resp.Body))
+}
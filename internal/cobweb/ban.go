@@ -0,0 +1,97 @@
+package cobweb
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/valyala/fasthttp"
+)
+
+// BanDetector checks downloaded response before it goes to parse stage
+// a banned response marks request host as banned for downloader used,
+// decreases score of its proxy and the command is downloaded again
+type BanDetector interface {
+	// return reason of ban, or empty string if response is fine
+	DetectBan(req *fasthttp.Request, resp *fasthttp.Response) string
+}
+
+// responses are checked only if rule implements BanDetectorsRule,
+// DefaultBanDetectors could be returned by it
+type BanDetectorsRule interface {
+	BanDetectors() []BanDetector
+}
+
+var DefaultBanDetectors = []BanDetector{
+	&StatusBanDetector{StatusCodes: []int{403}},
+}
+
+type BanDetectorFunc func(req *fasthttp.Request, resp *fasthttp.Response) string
+
+func (f BanDetectorFunc) DetectBan(req *fasthttp.Request, resp *fasthttp.Response) string {
+	return f(req, resp)
+}
+
+// response with one of StatusCodes is banned
+type StatusBanDetector struct {
+	StatusCodes []int
+}
+
+func (d *StatusBanDetector) DetectBan(_ *fasthttp.Request, resp *fasthttp.Response) string {
+	for _, code := range d.StatusCodes {
+		if resp.StatusCode() == code {
+			return fmt.Sprintf("status code %d", code)
+		}
+	}
+	return ""
+}
+
+// response whose Header matches Pattern is banned
+type HeaderBanDetector struct {
+	Header  string
+	Pattern *regexp.Regexp
+}
+
+func (d *HeaderBanDetector) DetectBan(_ *fasthttp.Request, resp *fasthttp.Response) string {
+	val := resp.Header.Peek(d.Header)
+	if len(val) != 0 && d.Pattern.Match(val) {
+		return fmt.Sprintf("header %s: %s", d.Header, val)
+	}
+	return ""
+}
+
+// response whose body contains one of Markers is banned,
+// e.g. text of captcha page, body is decoded to utf-8 before matching
+type BodyBanDetector struct {
+	Markers []string
+}
+
+func (d *BodyBanDetector) DetectBan(_ *fasthttp.Request, resp *fasthttp.Response) string {
+	body, _, err := decodeBody(resp.Body(), responseContentType(resp), "")
+	if err != nil {
+		body = resp.Body()
+	}
+	for _, marker := range d.Markers {
+		if bytes.Contains(body, []byte(marker)) {
+			return fmt.Sprintf("body contains %q", marker)
+		}
+	}
+	return ""
+}
+
+// response redirected to location matching Pattern is banned,
+// e.g. redirected to login or verification page
+type RedirectBanDetector struct {
+	Pattern *regexp.Regexp
+}
+
+func (d *RedirectBanDetector) DetectBan(_ *fasthttp.Request, resp *fasthttp.Response) string {
+	if !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) {
+		return ""
+	}
+	location := resp.Header.Peek(fasthttp.HeaderLocation)
+	if len(location) != 0 && d.Pattern.Match(location) {
+		return fmt.Sprintf("redirect to %s", location)
+	}
+	return ""
+}
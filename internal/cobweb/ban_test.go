@@ -0,0 +1,70 @@
+package cobweb
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestBanDetectors(t *testing.T) {
+	req := &fasthttp.Request{}
+	req.SetRequestURI("https://movie.douban.com/subject/1/")
+	resp := &fasthttp.Response{}
+
+	status := &StatusBanDetector{StatusCodes: []int{403}}
+	header := &HeaderBanDetector{Header: "X-Captcha", Pattern: regexp.MustCompile("^1$")}
+	body := &BodyBanDetector{Markers: []string{"请输入验证码"}}
+	redirect := &RedirectBanDetector{Pattern: regexp.MustCompile(`sec\.douban\.com`)}
+
+	resp.SetStatusCode(200)
+	resp.SetBodyString("<html>ok</html>")
+	for _, detector := range []BanDetector{status, header, body, redirect} {
+		assert.Empty(t, detector.DetectBan(req, resp))
+	}
+
+	resp.SetStatusCode(403)
+	assert.Equal(t, "status code 403", status.DetectBan(req, resp))
+
+	resp.SetStatusCode(200)
+	resp.Header.Set("X-Captcha", "1")
+	assert.NotEmpty(t, header.DetectBan(req, resp))
+
+	resp.SetBodyString("<html>请输入验证码</html>")
+	assert.NotEmpty(t, body.DetectBan(req, resp))
+
+	resp.SetStatusCode(302)
+	resp.Header.Set("Location", "https://sec.douban.com/verify")
+	assert.NotEmpty(t, redirect.DetectBan(req, resp))
+}
+
+type banTestRule struct {
+	frontierTestRule
+}
+
+func (r *banTestRule) BanDetectors() []BanDetector {
+	return []BanDetector{
+		BanDetectorFunc(func(_ *fasthttp.Request, resp *fasthttp.Response) string {
+			if resp.StatusCode() == 200 && len(resp.Body()) == 0 {
+				return "empty body"
+			}
+			return ""
+		}),
+	}
+}
+
+func TestTaskDetectBan(t *testing.T) {
+	cmd := &command{downloadRequest: &fasthttp.Request{}, downloadResponse: &fasthttp.Response{}}
+
+	// no detector without BanDetectorsRule
+	cmd.task = newTaskFromRule(&frontierTestRule{}, NewMemoryFrontier())
+	cmd.response().SetStatusCode(403)
+	assert.Empty(t, cmd.task.detectBan(cmd))
+	cmd.response().SetStatusCode(200)
+
+	cmd.task = newTaskFromRule(&banTestRule{}, NewMemoryFrontier())
+	assert.Equal(t, "empty body", cmd.task.detectBan(cmd))
+	cmd.response().SetStatusCode(403)
+	assert.Empty(t, cmd.task.detectBan(cmd))
+}
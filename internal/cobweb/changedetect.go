@@ -0,0 +1,189 @@
+package cobweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ItemChange string
+
+const (
+	ItemNew       ItemChange = "new"
+	ItemUpdated   ItemChange = "updated"
+	ItemUnchanged ItemChange = "unchanged"
+)
+
+const (
+	// string field of item tagged by it is the ID of item in fingerprint store
+	// items without ID field are identified by their content
+	itemTagID = "id"
+	// string field of item tagged by it is set to ItemChange, item has to be a pointer
+	itemTagChange = "change"
+)
+
+// ChangeDetectPipeline passes new and updated items to Pipelines,
+// fingerprints of items are saved to FilePath and compared by next run
+//
+//	type Movie struct {
+//		URL    string `cobweb:"id"`
+//		Title  string
+//		Change string `cobweb:"change"`
+//	}
+type ChangeDetectPipeline struct {
+	Pipelines []Pipeline
+	// unchanged items are passed to Pipelines too
+	EmitUnchanged bool
+	// instance/fingerprints/[task name].json if it is empty
+	FilePath string
+
+	loadOnce sync.Once
+	store    *itemFingerprintStore
+}
+
+func (p *ChangeDetectPipeline) Pipe(info *itemInfo) {
+	task := info.ctx.cmd.task
+	p.loadOnce.Do(func() {
+		if p.FilePath == "" {
+			p.FilePath = path.Join("instance", "fingerprints", task.Name()+".json")
+		}
+		p.store = newItemFingerprintStore(p.FilePath)
+	})
+
+	change, err := p.store.check(info.item)
+	if err != nil {
+		// item is passed on, it may be duplicated
+		logrus.WithFields(info.logrusFields()).WithField("Error", err).Error("item fingerprint failed")
+		change = ItemNew
+	}
+	setItemChange(info.item, change)
+	task.recordItemChange(change)
+
+	if change == ItemUnchanged && !p.EmitUnchanged {
+		return
+	}
+	for _, pipeline := range p.Pipelines {
+		pipeline.Pipe(info)
+	}
+}
+
+func (p *ChangeDetectPipeline) Close() {
+	for _, pipeline := range p.Pipelines {
+		pipeline.Close()
+	}
+	if p.store == nil {
+		return
+	}
+	if err := p.store.save(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":    err,
+			"FilePath": p.FilePath,
+		}).Error("save item fingerprints failed")
+	}
+}
+
+// [item type] [ID] -> content hash
+type itemFingerprintStore struct {
+	filePath string
+
+	locker       sync.Mutex
+	fingerprints map[string]string
+}
+
+func newItemFingerprintStore(filePath string) *itemFingerprintStore {
+	s := &itemFingerprintStore{
+		filePath:     filePath,
+		fingerprints: make(map[string]string),
+	}
+	data, err := ioutil.ReadFile(filePath)
+	if err == nil {
+		err = json.Unmarshal(data, &s.fingerprints)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logrus.WithFields(logrus.Fields{
+			"Error":    err,
+			"FilePath": filePath,
+		}).Error("load item fingerprints failed")
+	}
+	return s
+}
+
+// compare item with its fingerprint of last run, fingerprint is updated
+func (s *itemFingerprintStore) check(item interface{}) (ItemChange, error) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(data)
+	hash := hex.EncodeToString(h[:])
+
+	itemValue := reflect.Indirect(reflect.ValueOf(item))
+	id, ok := itemTaggedField(itemValue, itemTagID)
+	if !ok || id.String() == "" {
+		id = reflect.ValueOf(hash)
+	}
+	key := itemValue.Type().String() + " " + id.String()
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	old, ok := s.fingerprints[key]
+	s.fingerprints[key] = hash
+	switch {
+	case !ok:
+		return ItemNew, nil
+	case old != hash:
+		return ItemUpdated, nil
+	default:
+		return ItemUnchanged, nil
+	}
+}
+
+func (s *itemFingerprintStore) save() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	data, err := json.MarshalIndent(s.fingerprints, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(s.filePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := s.filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.filePath)
+}
+
+// string field of struct value tagged by cobweb:"[tag]"
+func itemTaggedField(value reflect.Value, tag string) (reflect.Value, bool) {
+	if value.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if field.Tag.Get("cobweb") == tag && field.Type.Kind() == reflect.String {
+			return value.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// change is set to item if it is a pointer with change field
+func setItemChange(item interface{}, change ItemChange) {
+	itemValue := reflect.ValueOf(item)
+	if itemValue.Kind() != reflect.Ptr {
+		return
+	}
+	field, ok := itemTaggedField(itemValue.Elem(), itemTagChange)
+	if ok && field.CanSet() {
+		field.SetString(string(change))
+	}
+}
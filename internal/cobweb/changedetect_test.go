@@ -0,0 +1,64 @@
+package cobweb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type changeTestItem struct {
+	URL    string `cobweb:"id"`
+	Title  string
+	Change string `cobweb:"change"`
+}
+
+type recordPipeline struct {
+	items []interface{}
+}
+
+func (p *recordPipeline) Pipe(info *itemInfo) {
+	p.items = append(p.items, info.item)
+}
+
+func (p *recordPipeline) Close() {
+}
+
+func TestChangeDetectPipeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-fingerprints")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "fingerprints.json")
+
+	run := func(items ...*changeTestItem) (*Task, *recordPipeline) {
+		task := newInMemoryJarTask(&frontierTestRule{})
+		b := newCommandBuilder(task)
+		b.Link("http://a.com/")
+		ctx := newContext(b.build())
+
+		record := &recordPipeline{}
+		pipeline := &ChangeDetectPipeline{Pipelines: []Pipeline{record}, FilePath: filePath}
+		for _, item := range items {
+			pipeline.Pipe(&itemInfo{ctx: ctx, item: item})
+		}
+		pipeline.Close()
+		return task, record
+	}
+
+	_, record := run(&changeTestItem{URL: "1", Title: "a"}, &changeTestItem{URL: "2", Title: "b"})
+	assert.Len(t, record.items, 2)
+	assert.Equal(t, string(ItemNew), record.items[0].(*changeTestItem).Change)
+
+	task, record := run(
+		&changeTestItem{URL: "1", Title: "a"},
+		&changeTestItem{URL: "2", Title: "c"},
+		&changeTestItem{URL: "3", Title: "d"},
+	)
+	assert.Len(t, record.items, 2)
+	assert.Equal(t, "2", record.items[0].(*changeTestItem).URL)
+	assert.Equal(t, string(ItemUpdated), record.items[0].(*changeTestItem).Change)
+	assert.Equal(t, string(ItemNew), record.items[1].(*changeTestItem).Change)
+	assert.Equal(t, map[ItemChange]int{ItemNew: 1, ItemUpdated: 1, ItemUnchanged: 1}, task.itemChangeCounts)
+}
@@ -0,0 +1,53 @@
+package cobweb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+// CharsetRule sets charset of every response of task,
+// otherwise charset is found from BOM, Content-Type and meta tags
+type CharsetRule interface {
+	Charset() string
+}
+
+// Content-Type header of resp, fasthttp returns text/plain; charset=utf-8 if it doesn't exist
+func responseContentType(resp *fasthttp.Response) string {
+	resp.Header.SetNoDefaultContentType(true)
+	defer resp.Header.SetNoDefaultContentType(false)
+	return string(resp.Header.ContentType())
+}
+
+// find encoding of body, forceCharset is used if it isn't empty
+func bodyEncoding(body []byte, contentType string, forceCharset string) (encoding.Encoding, string) {
+	if forceCharset != "" {
+		if enc, err := htmlindex.Get(forceCharset); err == nil {
+			name, _ := htmlindex.Name(enc)
+			return enc, name
+		}
+	}
+	enc, name, _ := charset.DetermineEncoding(body, contentType)
+	return enc, name
+}
+
+// decode body to utf-8, body is returned if it is utf-8 already
+func decodeBody(body []byte, contentType string, forceCharset string) ([]byte, string, error) {
+	enc, name := bodyEncoding(body, contentType, forceCharset)
+	if strings.EqualFold(name, "utf-8") {
+		// BOM is removed
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), name, nil
+	}
+
+	decoded, err := ioutil.ReadAll(transform.NewReader(bytes.NewReader(body), enc.NewDecoder()))
+	if err != nil {
+		return nil, name, err
+	}
+	return decoded, name, nil
+}
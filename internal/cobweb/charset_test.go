@@ -0,0 +1,49 @@
+package cobweb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+func TestContextCharset(t *testing.T) {
+	html := `<html><head><meta charset="gbk"><title>豆瓣电影</title></head><body><p>肖申克的救赎</p></body></html>`
+	gbkHTML, err := simplifiedchinese.GBK.NewEncoder().String(html)
+	assert.Nil(t, err)
+
+	newGBKContext := func(contentType string) *Context {
+		cmd := &command{
+			task:             &Task{},
+			downloadRequest:  &fasthttp.Request{},
+			downloadResponse: &fasthttp.Response{},
+		}
+		cmd.response().SetBodyString(gbkHTML)
+		if contentType != "" {
+			cmd.response().Header.SetContentType(contentType)
+		}
+		return newContext(cmd)
+	}
+
+	// meta tag
+	ctx := newGBKContext("")
+	assert.Equal(t, "豆瓣电影", ctx.Doc().Find("title").Text())
+	assert.Equal(t, "gbk", ctx.Charset())
+	assert.Equal(t, gbkHTML, string(ctx.RawBody()))
+
+	// content type
+	ctx = newGBKContext("text/html; charset=gb2312")
+	assert.Contains(t, ctx.Text(), "肖申克的救赎")
+
+	// task charset
+	ctx = newGBKContext("text/html; charset=utf-8")
+	ctx.cmd.task.charset = "gb18030"
+	assert.Contains(t, ctx.Text(), "肖申克的救赎")
+
+	// BOM
+	ctx = newGBKContext("")
+	ctx.cmd.response().SetBodyString("\xef\xbb\xbf" + html)
+	assert.Equal(t, html, ctx.Text())
+	assert.Equal(t, "utf-8", ctx.Charset())
+}
@@ -0,0 +1,615 @@
+package cobweb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/sirupsen/logrus"
+)
+
+// cluster mode
+//
+// Coordinator owns tasks and the frontier, it serves http requests of workers.
+// Worker is an Executor whose frontier is the coordinator,
+// it leases batches of commands, downloads and parses them,
+// and reports new commands, stats and items back.
+// Leases of worker which stops heartbeat are pushed back to the frontier,
+// so are leases of worker which is stopped.
+// items of every worker are piped one by one by a single routine of coordinator.
+//
+// messages are encoded by gob, so context data and items keep their types.
+// types of items and context data other than builtin ones
+// have to be registered by gob.Register in both coordinator and workers.
+
+const (
+	clusterPathLease     = "/cobweb/lease"
+	clusterPathAck       = "/cobweb/ack"
+	clusterPathPush      = "/cobweb/push"
+	clusterPathSeen      = "/cobweb/seen"
+	clusterPathIncrStat  = "/cobweb/stats/incr"
+	clusterPathStats     = "/cobweb/stats"
+	clusterPathItem      = "/cobweb/item"
+	clusterPathHeartbeat = "/cobweb/heartbeat"
+	clusterPathRelease   = "/cobweb/release"
+)
+
+const (
+	DefaultClusterLeaseTTL       = time.Second * 30
+	DefaultClusterLeaseBatchSize = 20
+)
+
+type clusterRequest struct {
+	WorkerID string
+
+	// lease
+	Count   int
+	Timeout time.Duration
+
+	// ack
+	LeaseID string
+
+	// push and item
+	Spec *CommandSpec
+	// item emitted by rule, its type has to be registered by gob.Register
+	Item interface{}
+
+	// seen and stats
+	TaskID      string
+	Fingerprint string
+	Key         string
+	Delta       int64
+}
+
+type clusterResponse struct {
+	Error string
+
+	Leases []*clusterLease
+	Added  bool
+	Value  int64
+	Stats  map[string]int64
+}
+
+type clusterLease struct {
+	ID   string
+	Spec *CommandSpec
+
+	workerID string
+	deadline time.Time
+}
+
+// Coordinator owns tasks and the frontier of cluster
+type Coordinator struct {
+	frontier Frontier
+	leaseTTL time.Duration
+
+	tasksLocker sync.RWMutex
+	tasks       map[string]*Task
+
+	leasesLocker sync.Mutex
+	leases       map[string]*clusterLease
+
+	// pipelines aren't safe for concurrent use
+	items chan *coordinatorItem
+
+	server *http.Server
+
+	stopOnce    sync.Once
+	stopWg      sync.WaitGroup
+	stopChannel chan struct{}
+}
+
+func NewCoordinator(frontier Frontier, leaseTTL time.Duration) *Coordinator {
+	c := &Coordinator{
+		frontier:    frontier,
+		leaseTTL:    leaseTTL,
+		tasks:       make(map[string]*Task),
+		leases:      make(map[string]*clusterLease),
+		items:       make(chan *coordinatorItem),
+		stopChannel: make(chan struct{}),
+	}
+
+	c.stopWg.Add(2)
+	go c.requeueExpiredLeasesRoutine()
+	go c.pipeItemRoutine()
+	return c
+}
+
+// item waiting for pipe routine, done is closed after it's piped
+type coordinatorItem struct {
+	info *itemInfo
+	done chan struct{}
+}
+
+// accept rule and push its init commands to frontier
+// items reported by workers are piped by rule's pipelines in coordinator
+func (c *Coordinator) AcceptRule(rule BaseRule) *Task {
+	task := newTaskFromRule(rule, c.frontier)
+	if task.ruleErr != nil {
+		logrus.WithFields(task.logrusFields()).WithField("Error", task.ruleErr).Error("Cobweb coordinator reject rule, invalid rule.")
+		return nil
+	}
+	c.tasksLocker.Lock()
+	c.tasks[task.ID()] = task
+	c.tasksLocker.Unlock()
+
+	initCMDs := task.initCommands()
+	for _, cmd := range initCMDs {
+		scheduleCommand(c.frontier, cmd)
+	}
+	logrus.WithFields(logrus.Fields{
+		"TaskName":     task.Name(),
+		"InitCMDCount": len(initCMDs),
+	}).Info("Cobweb coordinator accept rule.")
+	return task
+}
+
+func (c *Coordinator) taskByID(taskID string) *Task {
+	c.tasksLocker.RLock()
+	defer c.tasksLocker.RUnlock()
+	return c.tasks[taskID]
+}
+
+// serve workers at addr, block until coordinator stopped
+func (c *Coordinator) ListenAndServe(addr string) error {
+	c.server = &http.Server{Addr: addr, Handler: c}
+	err := c.server.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (c *Coordinator) Stop() {
+	c.stopOnce.Do(func() {
+		logrus.Info("Cobweb coordinator stopping...")
+		close(c.stopChannel)
+		if c.server != nil {
+			c.server.Close()
+		}
+	})
+	c.stopWg.Wait()
+	logrus.Info("Cobweb coordinator stopped.")
+}
+
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &clusterRequest{}
+	if err := gob.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp *clusterResponse
+	var err error
+	switch r.URL.Path {
+	case clusterPathLease:
+		resp, err = c.lease(req)
+	case clusterPathAck:
+		resp, err = c.ack(req)
+	case clusterPathPush:
+		resp, err = &clusterResponse{}, c.frontier.Push(req.Spec)
+	case clusterPathSeen:
+		resp, err = c.addSeen(req)
+	case clusterPathIncrStat:
+		resp, err = c.incrStat(req)
+	case clusterPathStats:
+		resp, err = c.stats(req)
+	case clusterPathItem:
+		resp, err = c.pipeItem(req)
+	case clusterPathHeartbeat:
+		resp, err = c.heartbeat(req)
+	case clusterPathRelease:
+		resp, err = c.release(req)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		resp = &clusterResponse{Error: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/x-gob")
+	if err := gob.NewEncoder(w).Encode(resp); err != nil {
+		logrus.WithField("Error", err).Error("coordinator encode response failed")
+	}
+}
+
+// pop at most req.Count specs, only the first pop waits
+func (c *Coordinator) lease(req *clusterRequest) (*clusterResponse, error) {
+	resp := &clusterResponse{}
+	timeout := req.Timeout
+	for len(resp.Leases) < req.Count {
+		spec, err := c.frontier.Pop(timeout)
+		if err != nil {
+			return nil, err
+		} else if spec == nil {
+			break
+		}
+		timeout = time.Millisecond
+
+		l := &clusterLease{
+			ID:       xid.New().String(),
+			Spec:     spec,
+			workerID: req.WorkerID,
+			deadline: time.Now().Add(c.leaseTTL),
+		}
+		c.leasesLocker.Lock()
+		c.leases[l.ID] = l
+		c.leasesLocker.Unlock()
+		resp.Leases = append(resp.Leases, l)
+	}
+	return resp, nil
+}
+
+func (c *Coordinator) ack(req *clusterRequest) (*clusterResponse, error) {
+	c.leasesLocker.Lock()
+	l, ok := c.leases[req.LeaseID]
+	delete(c.leases, req.LeaseID)
+	c.leasesLocker.Unlock()
+	if !ok {
+		// lease expired and spec has been pushed back
+		return &clusterResponse{}, nil
+	}
+	return &clusterResponse{}, c.frontier.Ack(l.Spec)
+}
+
+func (c *Coordinator) heartbeat(req *clusterRequest) (*clusterResponse, error) {
+	deadline := time.Now().Add(c.leaseTTL)
+	c.leasesLocker.Lock()
+	defer c.leasesLocker.Unlock()
+	for _, l := range c.leases {
+		if l.workerID == req.WorkerID {
+			l.deadline = deadline
+		}
+	}
+	return &clusterResponse{}, nil
+}
+
+func (c *Coordinator) addSeen(req *clusterRequest) (*clusterResponse, error) {
+	added, err := c.frontier.AddSeen(req.TaskID, req.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterResponse{Added: added}, nil
+}
+
+func (c *Coordinator) incrStat(req *clusterRequest) (*clusterResponse, error) {
+	val, err := c.frontier.IncrStat(req.TaskID, req.Key, req.Delta)
+	if err != nil {
+		return nil, err
+	}
+	if task := c.taskByID(req.TaskID); task != nil && req.Delta < 0 {
+		task.checkFinish()
+	}
+	return &clusterResponse{Value: val}, nil
+}
+
+func (c *Coordinator) stats(req *clusterRequest) (*clusterResponse, error) {
+	stats, err := c.frontier.Stats(req.TaskID)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterResponse{Stats: stats}, nil
+}
+
+// pipe item reported by worker with task's pipelines
+// worker records item stats itself
+func (c *Coordinator) pipeItem(req *clusterRequest) (*clusterResponse, error) {
+	if req.Spec == nil {
+		return nil, fmt.Errorf("item without command spec")
+	}
+	task := c.taskByID(req.Spec.TaskID)
+	if task == nil {
+		return nil, fmt.Errorf("unknown task %v", req.Spec.TaskID)
+	}
+
+	b := newCommandBuilder(task)
+	b.Link(req.Spec.URL)
+	b.ContextData(req.Spec.ContextData)
+	cmd := b.build()
+	item := &coordinatorItem{
+		info: &itemInfo{
+			ctx:  newContext(cmd),
+			item: req.Item,
+		},
+		done: make(chan struct{}),
+	}
+	select {
+	case c.items <- item:
+	case <-c.stopChannel:
+		return nil, fmt.Errorf("coordinator is stopping")
+	}
+	// response is sent after item is piped, so items are piped before task finished
+	select {
+	case <-item.done:
+	case <-c.stopChannel:
+	}
+	return &clusterResponse{}, nil
+}
+
+func (c *Coordinator) pipeItemRoutine() {
+	defer c.stopWg.Done()
+	for {
+		select {
+		case item := <-c.items:
+			for _, pipeline := range item.info.ctx.cmd.task.pipelines() {
+				pipeline.Pipe(item.info)
+			}
+			close(item.done)
+		case <-c.stopChannel:
+			return
+		}
+	}
+}
+
+// push leases of stopped worker back to frontier
+func (c *Coordinator) release(req *clusterRequest) (*clusterResponse, error) {
+	released := make([]*clusterLease, 0)
+	c.leasesLocker.Lock()
+	for id, l := range c.leases {
+		if l.workerID == req.WorkerID {
+			released = append(released, l)
+			delete(c.leases, id)
+		}
+	}
+	c.leasesLocker.Unlock()
+
+	c.requeueLeases(released, "worker stopped, push command back to frontier")
+	return &clusterResponse{}, nil
+}
+
+func (c *Coordinator) requeueExpiredLeasesRoutine() {
+	defer c.stopWg.Done()
+
+	ticker := time.NewTicker(c.leaseTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.requeueExpiredLeases()
+		case <-c.stopChannel:
+			return
+		}
+	}
+}
+
+func (c *Coordinator) requeueExpiredLeases() {
+	nt := time.Now()
+	expiredLeases := make([]*clusterLease, 0)
+	c.leasesLocker.Lock()
+	for id, l := range c.leases {
+		if l.deadline.Before(nt) {
+			expiredLeases = append(expiredLeases, l)
+			delete(c.leases, id)
+		}
+	}
+	c.leasesLocker.Unlock()
+
+	c.requeueLeases(expiredLeases, "lease expired, push command back to frontier")
+}
+
+func (c *Coordinator) requeueLeases(leases []*clusterLease, reason string) {
+	for _, l := range leases {
+		logrus.WithFields(logrus.Fields{
+			"WorkerID": l.workerID,
+			"URL":      l.Spec.URL,
+		}).Warn(reason)
+		if err := c.frontier.Push(l.Spec); err != nil {
+			logrus.WithField("Error", err).Error("push command back failed")
+			continue
+		}
+		c.frontier.Ack(l.Spec)
+	}
+}
+
+// Worker runs commands leased from coordinator
+type Worker struct {
+	id       string
+	frontier *clusterFrontier
+	executor *Executor
+}
+
+// newExecutor creates the executor of worker with given frontier,
+// e.g. func(f Frontier) *Executor { return NewDefaultExecutorWithFrontier(storage, f) }
+func NewWorker(coordinatorURL string, newExecutor func(frontier Frontier) *Executor) *Worker {
+	w := &Worker{id: xid.New().String()}
+	w.frontier = newClusterFrontier(coordinatorURL, w.id, DefaultClusterLeaseBatchSize, DefaultClusterLeaseTTL/3)
+	w.executor = newExecutor(w.frontier)
+	w.executor.newTask = w.newTask
+	return w
+}
+
+func (w *Worker) ID() string {
+	return w.id
+}
+
+// rules of tasks worker could run
+func (w *Worker) RegisterRule(rule BaseRule) error {
+	return w.executor.RegisterRule(rule)
+}
+
+// commands leased by worker and not acked are pushed back by coordinator
+func (w *Worker) Stop() {
+	w.executor.Stop()
+	w.frontier.Close()
+}
+
+// items of worker's task are sent to coordinator
+func (w *Worker) newTask(rule BaseRule, id xid.ID) *Task {
+	task := newTaskWithID(rule, w.frontier, id)
+	if task.ruleErr != nil {
+		return task
+	}
+	task.itemPipelines = []Pipeline{
+		&clusterItemPipeline{frontier: w.frontier},
+	}
+	return task
+}
+
+// clusterFrontier is the Frontier of worker, every method is a request to coordinator
+type clusterFrontier struct {
+	baseURL   string
+	workerID  string
+	batchSize int
+	client    *http.Client
+
+	leasesLocker sync.Mutex
+	leases       []*clusterLease
+
+	stopOnce    sync.Once
+	stopChannel chan struct{}
+}
+
+func newClusterFrontier(baseURL, workerID string, batchSize int, heartbeatInterval time.Duration) *clusterFrontier {
+	f := &clusterFrontier{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		workerID:    workerID,
+		batchSize:   batchSize,
+		client:      &http.Client{Timeout: time.Minute},
+		stopChannel: make(chan struct{}),
+	}
+	go f.heartbeatRoutine(heartbeatInterval)
+	return f
+}
+
+func (f *clusterFrontier) do(path string, req *clusterRequest) (*clusterResponse, error) {
+	req.WorkerID = f.workerID
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(req); err != nil {
+		return nil, err
+	}
+
+	httpResp, err := f.client.Post(f.baseURL+path, "application/x-gob", &buf)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coordinator response status %v", httpResp.StatusCode)
+	}
+
+	resp := &clusterResponse{}
+	if err := gob.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
+
+func (f *clusterFrontier) heartbeatRoutine(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := f.do(clusterPathHeartbeat, &clusterRequest{}); err != nil {
+				logrus.WithField("Error", err).Error("worker heartbeat failed")
+			}
+		case <-f.stopChannel:
+			return
+		}
+	}
+}
+
+func (f *clusterFrontier) Push(spec *CommandSpec) error {
+	_, err := f.do(clusterPathPush, &clusterRequest{Spec: spec})
+	return err
+}
+
+// pop spec from leased batch, lease a new batch if it's empty
+func (f *clusterFrontier) Pop(timeout time.Duration) (*CommandSpec, error) {
+	f.leasesLocker.Lock()
+	defer f.leasesLocker.Unlock()
+
+	if len(f.leases) == 0 {
+		resp, err := f.do(clusterPathLease, &clusterRequest{
+			Count:   f.batchSize,
+			Timeout: timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		f.leases = resp.Leases
+	}
+	if len(f.leases) == 0 {
+		return nil, nil
+	}
+
+	l := f.leases[0]
+	f.leases = f.leases[1:]
+	l.Spec.raw = []byte(l.ID)
+	return l.Spec, nil
+}
+
+func (f *clusterFrontier) Ack(spec *CommandSpec) error {
+	if spec == nil || spec.raw == nil {
+		return nil
+	}
+	_, err := f.do(clusterPathAck, &clusterRequest{LeaseID: string(spec.raw)})
+	return err
+}
+
+func (f *clusterFrontier) AddSeen(taskID, fingerprint string) (bool, error) {
+	resp, err := f.do(clusterPathSeen, &clusterRequest{TaskID: taskID, Fingerprint: fingerprint})
+	if err != nil {
+		return false, err
+	}
+	return resp.Added, nil
+}
+
+func (f *clusterFrontier) IncrStat(taskID, key string, delta int64) (int64, error) {
+	resp, err := f.do(clusterPathIncrStat, &clusterRequest{TaskID: taskID, Key: key, Delta: delta})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Value, nil
+}
+
+func (f *clusterFrontier) Stats(taskID string) (map[string]int64, error) {
+	resp, err := f.do(clusterPathStats, &clusterRequest{TaskID: taskID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Stats, nil
+}
+
+func (f *clusterFrontier) pipeItem(info *itemInfo) error {
+	spec := newCommandSpec(info.ctx.cmd)
+	spec.ContextData = info.ctx.data
+	_, err := f.do(clusterPathItem, &clusterRequest{Spec: spec, Item: info.item})
+	return err
+}
+
+// leases of worker are released
+func (f *clusterFrontier) Close() error {
+	var err error
+	f.stopOnce.Do(func() {
+		close(f.stopChannel)
+		f.leasesLocker.Lock()
+		f.leases = nil
+		f.leasesLocker.Unlock()
+		_, err = f.do(clusterPathRelease, &clusterRequest{})
+	})
+	return err
+}
+
+// clusterItemPipeline sends items of worker to coordinator
+type clusterItemPipeline struct {
+	frontier *clusterFrontier
+}
+
+func (p *clusterItemPipeline) Pipe(info *itemInfo) {
+	if err := p.frontier.pipeItem(info); err != nil {
+		logrus.WithFields(info.logrusFields()).WithField("Error", err).Error("send item to coordinator failed")
+	}
+}
+
+func (p *clusterItemPipeline) Close() {
+}
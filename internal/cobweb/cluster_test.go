@@ -0,0 +1,146 @@
+package cobweb
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type clusterTestItem struct {
+	Title string
+}
+
+type clusterTestPipeline struct {
+	locker sync.Mutex
+	titles []string
+}
+
+func (p *clusterTestPipeline) Pipe(info *itemInfo) {
+	item := info.item.(*clusterTestItem)
+	p.locker.Lock()
+	p.titles = append(p.titles, item.Title)
+	p.locker.Unlock()
+}
+
+func (p *clusterTestPipeline) Close() {
+}
+
+type clusterTestRule struct {
+	siteURL  string
+	pipeline *clusterTestPipeline
+}
+
+func (r *clusterTestRule) InitLinks() []string {
+	return []string{r.siteURL + "/"}
+}
+
+func (r *clusterTestRule) InitParse(ctx *Context) {
+	ctx.HTML("a", func(element *HTMLElement) {
+		ctx.Follow(element.Attr("href"), r.parseDetail)
+	})
+}
+
+func (r *clusterTestRule) parseDetail(ctx *Context) {
+	ctx.HTML("title", func(element *HTMLElement) {
+		ctx.Item(&clusterTestItem{Title: element.Text()})
+	})
+}
+
+func (r *clusterTestRule) Callbacks() []OnParseCallback {
+	return []OnParseCallback{r.parseDetail}
+}
+
+func (r *clusterTestRule) Pipelines() []Pipeline {
+	return []Pipeline{r.pipeline}
+}
+
+func TestCluster(t *testing.T) {
+	gob.Register(&clusterTestItem{})
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<html><title>%v</title><a href="/a">a</a><a href="/b">b</a></html>`, r.URL.Path)
+	}))
+	defer site.Close()
+
+	coordinator := NewCoordinator(NewMemoryFrontier(), time.Second)
+	defer coordinator.Stop()
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	pipeline := &clusterTestPipeline{}
+	task := coordinator.AcceptRule(&clusterTestRule{siteURL: site.URL, pipeline: pipeline})
+
+	worker := NewWorker(server.URL, func(frontier Frontier) *Executor {
+		return NewExecutor(NewMemoryProxyStorage(), frontier, &NoProxyFastHTTPDownloaderFactory{}, 1, 10, 10, time.Millisecond)
+	})
+	defer worker.Stop()
+	assert.Nil(t, worker.RegisterRule(&clusterTestRule{siteURL: site.URL, pipeline: &clusterTestPipeline{}}))
+
+	finished := make(chan struct{})
+	go func() {
+		task.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(time.Second * 20):
+		t.Fatal("cluster task is not finished")
+	}
+
+	assert.ElementsMatch(t, []string{"/a", "/b"}, pipeline.titles)
+	stats, err := task.Stats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats[TaskStatCompletedCMD])
+	assert.Equal(t, int64(0), stats[TaskStatRunningCMD])
+}
+
+func TestClusterLeaseExpire(t *testing.T) {
+	frontier := NewMemoryFrontier()
+	coordinator := NewCoordinator(frontier, time.Millisecond*100)
+	defer coordinator.Stop()
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	coordinator.AcceptRule(&clusterTestRule{siteURL: "http://127.0.0.1"})
+
+	// worker dies without heartbeat after leasing
+	deadWorker := newClusterFrontier(server.URL, "dead", 10, time.Hour)
+	defer deadWorker.Close()
+	spec, err := deadWorker.Pop(time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, spec)
+
+	spec, err = frontier.Pop(time.Second)
+	assert.NoError(t, err)
+	if assert.NotNil(t, spec) {
+		assert.Equal(t, "http://127.0.0.1/", spec.URL)
+	}
+}
+
+func TestClusterWorkerRelease(t *testing.T) {
+	frontier := NewMemoryFrontier()
+	coordinator := NewCoordinator(frontier, time.Hour)
+	defer coordinator.Stop()
+	server := httptest.NewServer(coordinator)
+	defer server.Close()
+
+	coordinator.AcceptRule(&clusterTestRule{siteURL: "http://127.0.0.1"})
+
+	// leases of stopped worker are pushed back without waiting for ttl
+	worker := newClusterFrontier(server.URL, "stopped", 10, time.Hour)
+	spec, err := worker.Pop(time.Second)
+	assert.NoError(t, err)
+	assert.NotNil(t, spec)
+	assert.NoError(t, worker.Close())
+
+	spec, err = frontier.Pop(time.Second)
+	assert.NoError(t, err)
+	if assert.NotNil(t, spec) {
+		assert.Equal(t, "http://127.0.0.1/", spec.URL)
+	}
+}
@@ -18,6 +18,10 @@ func (kind ParseErrorKind) String() string {
 		return "ParseHTMLError"
 	case HTMLNodeNotFoundError:
 		return "HTMLNodeNotFoundError"
+	case ParseFeedError:
+		return "ParseFeedError"
+	case ParseJSONError:
+		return "ParseJSONError"
 	case UnknownParseError:
 		return "UnknownParseError"
 	default:
@@ -29,6 +33,8 @@ const (
 	UnknownParseError ParseErrorKind = iota
 	ParseHTMLError
 	HTMLNodeNotFoundError
+	ParseFeedError
+	ParseJSONError
 )
 
 type ParseErrorInfo struct {
@@ -60,6 +66,8 @@ type PipeErrorInfo struct {
 	PanicInfo interface{}
 }
 
+const DefaultUserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.97 Safari/537.36"
+
 type commandBuilder struct {
 	task *Task
 
@@ -70,6 +78,15 @@ type commandBuilder struct {
 
 	parseCallback   OnParseCallback
 	downloadTimeout time.Duration
+	dontFilter      bool
+	noCookies       bool
+
+	// for stream download
+	stream       bool
+	streamFile   string
+	maxSize      int64
+	checksumAlgo string
+	checksum     string
 
 	// for context data
 	contextData H
@@ -78,7 +95,7 @@ type commandBuilder struct {
 func newCommandBuilder(task *Task) *commandBuilder {
 	return &commandBuilder{
 		task:            task,
-		userAgent:       "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/83.0.4103.97 Safari/537.36",
+		userAgent:       DefaultUserAgent,
 		downloadTimeout: DefaultDownloadTimeout,
 		cookies:         make(map[string]string),
 		contextData:     make(H),
@@ -110,6 +127,50 @@ func (b *commandBuilder) DownloadTimeout(timeout time.Duration) *commandBuilder
 	return b
 }
 
+// command will not be dropped by dedup set
+func (b *commandBuilder) DontFilter() *commandBuilder {
+	b.dontFilter = true
+	return b
+}
+
+// cookie jar of task is neither applied to request nor updated by response
+func (b *commandBuilder) NoCookies() *commandBuilder {
+	b.noCookies = true
+	return b
+}
+
+// resource saved by SaveResource is streamed to file instead of kept in memory,
+// request is sent by GET without body
+func (b *commandBuilder) Stream() *commandBuilder {
+	b.stream = true
+	return b
+}
+
+// resource larger than maxSize bytes is not saved by SaveResource, it implies Stream
+func (b *commandBuilder) MaxSize(maxSize int64) *commandBuilder {
+	b.maxSize = maxSize
+	return b
+}
+
+// resource saved by SaveResource is checked by checksum,
+// algo is md5, sha1 or sha256, checksum is hex encoded, it implies Stream
+func (b *commandBuilder) Checksum(algo, checksum string) *commandBuilder {
+	b.checksumAlgo = algo
+	b.checksum = checksum
+	return b
+}
+
+// SaveResource streams resource if one of stream options is set
+func (b *commandBuilder) isStream() bool {
+	return b.stream || b.maxSize > 0 || b.checksum != ""
+}
+
+// response body is written to file in task folder
+func (b *commandBuilder) streamTo(fileName string) *commandBuilder {
+	b.streamFile = fileName
+	return b
+}
+
 func (b *commandBuilder) ContextData(data H) *commandBuilder {
 	for key, val := range data {
 		b.contextData[key] = val
@@ -124,12 +185,23 @@ func (b *commandBuilder) build() *command {
 		onParseCallback: b.parseCallback,
 		downloadTimeout: b.downloadTimeout,
 		contextData:     b.contextData.clone(),
+		dontFilter:      b.dontFilter,
+		noCookies:       b.noCookies,
+	}
+	if b.streamFile != "" {
+		cmd.stream = &streamOptions{
+			fileName:     b.streamFile,
+			maxSize:      b.maxSize,
+			checksumAlgo: b.checksumAlgo,
+			checksum:     b.checksum,
+		}
 	}
 
 	// build request
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(b.link)
 	req.Header.SetUserAgent(b.userAgent)
+	req.Header.Set(fasthttp.HeaderAcceptEncoding, acceptEncoding)
 	for k, v := range b.cookies {
 		req.Header.SetCookie(k, v)
 	}
@@ -160,17 +232,50 @@ type command struct {
 
 	downloadFailedCount int
 	parseFailedCount    int
+	// downloads with status retried by retry policy
+	statusRetryCount int
 
 	// context extra info data
 	contextData H
 
 	//
 	needRetry bool
+
+	// dedup info
+	dontFilter bool
+	seen       bool
+
+	noCookies bool
+	// key of cookie jar used by last download
+	cookieJarKey string
+	// generation of auth session used by last download
+	authGeneration int
+
+	// body is written to file if it isn't nil
+	stream *streamOptions
+
+	// copy of request before following redirects
+	originalRequest *fasthttp.Request
+	// urls visited by last download, empty if it isn't redirected
+	redirectChain []string
+
+	// key of http cache, empty if request isn't cacheable
+	cacheKey string
+	// response of last download is served from http cache
+	cacheHit bool
+	// cached response is validated by 304 response
+	cacheRevalidated bool
+
+	// spec popped from frontier, acked when command is finished
+	frontierSpec *CommandSpec
 }
 
 func (c *command) finalizer() {
 	fasthttp.ReleaseRequest(c.downloadRequest)
 	fasthttp.ReleaseResponse(c.downloadResponse)
+	if c.originalRequest != nil {
+		fasthttp.ReleaseRequest(c.originalRequest)
+	}
 }
 
 func (c *command) logrusFields() logrus.Fields {
@@ -182,10 +287,22 @@ func (c *command) logrusFields() logrus.Fields {
 		"DownloadErr":         c.downloadError,
 		"DownloadFailedCount": c.downloadFailedCount,
 		"ParseFailedCount":    c.parseFailedCount,
+		"StatusRetryCount":    c.statusRetryCount,
 		"Task":                c.task.logrusFields(),
 	}
 }
 
+func (c *command) ack() {
+	if c.frontierSpec == nil {
+		return
+	}
+	spec := c.frontierSpec
+	c.frontierSpec = nil
+	if err := c.task.frontier.Ack(spec); err != nil {
+		logrus.WithFields(c.logrusFields()).WithField("Error", err).Error("ack command failed")
+	}
+}
+
 func (c *command) retry() {
 	c.needRetry = true
 }
@@ -208,7 +325,98 @@ func (c *command) timeout() time.Duration {
 	return c.downloadTimeout
 }
 
+// set auth headers and cookies of task's cookie jar used by proxy
+func (c *command) downloadStart(proxy *Proxy) {
+	c.resetRequest()
+
+	if c.task.auth != nil {
+		c.authGeneration = c.task.auth.apply(c)
+	}
+
+	c.cookieJarKey = c.task.cookieJarKey(proxy)
+	c.applyCookies()
+}
+
+// download from the original url again
+func (c *command) resetRequest() {
+	if c.originalRequest != nil {
+		c.originalRequest.CopyTo(c.request())
+		c.redirectChain = nil
+	}
+}
+
+func (c *command) applyCookies() {
+	if c.noCookies || c.task.cookieJar == nil {
+		return
+	}
+	if c.cookieJarKey != "" {
+		// cookies of auth session are in the shared jar
+		c.task.cookieJar.apply("", c.request())
+	}
+	c.task.cookieJar.apply(c.cookieJarKey, c.request())
+}
+
+func (c *command) updateCookies() {
+	if c.noCookies || c.task.cookieJar == nil {
+		return
+	}
+	c.task.cookieJar.update(c.cookieJarKey, c.request().URI(), c.response())
+}
+
+// request of cmd is sent to location of redirect response
+func (c *command) redirected(statusCode int, location *fasthttp.URI) {
+	req := c.request()
+	if c.originalRequest == nil {
+		c.originalRequest = fasthttp.AcquireRequest()
+	}
+	if len(c.redirectChain) == 0 {
+		req.CopyTo(c.originalRequest)
+		c.redirectChain = append(c.redirectChain, req.URI().String())
+	}
+	c.updateCookies()
+
+	// like browsers, 307 and 308 keep method and body
+	if statusCode != fasthttp.StatusTemporaryRedirect && statusCode != fasthttp.StatusPermanentRedirect &&
+		!req.Header.IsGet() && !req.Header.IsHead() {
+		req.Header.SetMethod(fasthttp.MethodGet)
+		req.Header.Del(fasthttp.HeaderContentType)
+		req.ResetBody()
+	}
+	if string(location.Host()) != string(req.URI().Host()) {
+		req.Header.DelAllCookies()
+	}
+	req.SetRequestURIBytes(location.FullURI())
+	c.applyCookies()
+	c.redirectChain = append(c.redirectChain, req.URI().String())
+}
+
+// request sent before following redirects
+func (c *command) initialRequest() *fasthttp.Request {
+	if len(c.redirectChain) != 0 {
+		return c.originalRequest
+	}
+	return c.request()
+}
+
 func (c *command) downloadFinish(downloadError error) {
+	if downloadError == nil {
+		compressedLen, uncompressedLen, err := decompressResponse(c.response())
+		if err != nil {
+			downloadError = err
+		} else if !c.cacheHit {
+			// cached body isn't downloaded
+			c.task.recordDownloadedBytes(compressedLen, uncompressedLen)
+		}
+	}
+	if downloadError == nil {
+		c.updateCookies()
+		if c.task.httpCache != nil {
+			c.task.httpCache.store(c)
+		}
+		if c.cacheHit {
+			c.task.recordCacheHit(c)
+		}
+	}
 	c.task.onDownloadFinishCallback(c.createContext())
 	c.downloadError = downloadError
 	//return c.downloadError == nil
@@ -0,0 +1,65 @@
+package cobweb
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Accept-Encoding sent by every request
+const acceptEncoding = "gzip, deflate, br"
+
+// decode body of resp by Content-Encoding and remove the header,
+// return length of body before and after decoding
+func decompressResponse(resp *fasthttp.Response) (int, int, error) {
+	body := resp.Body()
+	compressedLen := len(body)
+
+	contentEncoding := string(resp.Header.Peek(fasthttp.HeaderContentEncoding))
+	if contentEncoding == "" {
+		return compressedLen, compressedLen, nil
+	}
+
+	// encodings are listed in the order they were applied
+	encodings := strings.Split(contentEncoding, ",")
+	decoded := false
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		switch strings.ToLower(strings.TrimSpace(encodings[i])) {
+		case "gzip", "x-gzip":
+			body, err = fasthttp.AppendGunzipBytes(nil, body)
+			decoded = true
+		case "deflate":
+			body, err = inflate(body)
+			decoded = true
+		case "br":
+			body, err = fasthttp.AppendUnbrotliBytes(nil, body)
+			decoded = true
+		case "identity", "":
+		default:
+			err = fmt.Errorf("unsupported content encoding %s", encodings[i])
+		}
+		if err != nil {
+			return compressedLen, 0, err
+		}
+	}
+
+	if decoded {
+		resp.SetBody(body)
+	}
+	resp.Header.Del(fasthttp.HeaderContentEncoding)
+	return compressedLen, len(body), nil
+}
+
+// deflate is zlib stream, but some servers send raw deflate stream
+func inflate(body []byte) ([]byte, error) {
+	decoded, err := fasthttp.AppendInflateBytes(nil, body)
+	if err == nil {
+		return decoded, nil
+	}
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(body)))
+}
@@ -0,0 +1,43 @@
+package cobweb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestDecompressResponse(t *testing.T) {
+	body := bytes.Repeat([]byte("<p>cobweb</p>"), 100)
+
+	for encoding, compress := range map[string]func(dst, src []byte) []byte{
+		"gzip":    fasthttp.AppendGzipBytes,
+		"deflate": fasthttp.AppendDeflateBytes,
+		"br":      fasthttp.AppendBrotliBytes,
+	} {
+		resp := &fasthttp.Response{}
+		resp.Header.Set(fasthttp.HeaderContentEncoding, encoding)
+		compressed := compress(nil, body)
+		resp.SetBody(compressed)
+
+		compressedLen, uncompressedLen, err := decompressResponse(resp)
+		assert.Nil(t, err, encoding)
+		assert.Equal(t, len(compressed), compressedLen, encoding)
+		assert.Equal(t, len(body), uncompressedLen, encoding)
+		assert.Equal(t, body, resp.Body(), encoding)
+		assert.Empty(t, resp.Header.Peek(fasthttp.HeaderContentEncoding), encoding)
+	}
+
+	resp := &fasthttp.Response{}
+	resp.Header.Set(fasthttp.HeaderContentEncoding, "gzip, br")
+	resp.SetBody(fasthttp.AppendBrotliBytes(nil, fasthttp.AppendGzipBytes(nil, body)))
+	_, _, err := decompressResponse(resp)
+	assert.Nil(t, err)
+	assert.Equal(t, body, resp.Body())
+
+	resp.Header.Set(fasthttp.HeaderContentEncoding, "gzip")
+	resp.SetBodyString("not gzip")
+	_, _, err = decompressResponse(resp)
+	assert.NotNil(t, err)
+}
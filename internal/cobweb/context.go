@@ -3,9 +3,11 @@ package cobweb
 import (
 	"bytes"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 
 	"github.com/SolarDomo/Cobweb/pkg/utils"
 
@@ -39,6 +41,14 @@ type Context struct {
 	cmds   []*command
 	iInfos []*itemInfo
 	data   H
+
+	// body decoded to utf-8
+	body        []byte
+	bodyCharset string
+
+	// <base href> of document, looked up once
+	base         *url.URL
+	baseResolved bool
 }
 
 func newContext(cmd *command) *Context {
@@ -89,11 +99,7 @@ func (c *Context) Follow(link string, callback OnParseCallback, data ...H) {
 }
 
 func (c *Context) FollowWithBuilder(link string, callback OnParseCallback, fBuilder *FollowBuilder) {
-	uri := fasthttp.AcquireURI()
-	defer fasthttp.ReleaseURI(uri)
-	c.cmd.downloadRequest.URI().CopyTo(uri)
-	uri.Update(link)
-	fBuilder.link = uri.String()
+	fBuilder.link = c.absURL(link)
 
 	fBuilder.Callback(callback)
 
@@ -101,7 +107,87 @@ func (c *Context) FollowWithBuilder(link string, callback OnParseCallback, fBuil
 	c.cmds = append(c.cmds, cmd)
 }
 
+// url of response, relative links passed to Follow are resolved against it
+func (c *Context) FinalURL() string {
+	return c.cmd.request().URI().String()
+}
+
+// every url visited by download, from requested url to FinalURL
+// nil if download isn't redirected
+func (c *Context) RedirectChain() []string {
+	if len(c.cmd.redirectChain) == 0 {
+		return nil
+	}
+	return append([]string(nil), c.cmd.redirectChain...)
+}
+
+// response is served from http cache, it may be revalidated by 304 response
+func (c *Context) FromCache() bool {
+	return c.cmd.cacheHit
+}
+
+// cookies of task's cookie jar sent with request of context, name -> value
+// Set-Cookie of response is already in it
+func (c *Context) Cookies() map[string]string {
+	if c.cmd.noCookies || c.cmd.task.cookieJar == nil {
+		return make(map[string]string)
+	}
+	return c.cmd.task.cookieJar.cookies(c.cmd.cookieJarKey, c.cmd.request().URI())
+}
+
+// link resolved against <base href> of html document or url of response
+func (c *Context) absURL(link string) string {
+	link = strings.TrimSpace(link)
+	if base := c.baseURL(); base != nil {
+		if ref, err := url.Parse(link); err == nil {
+			return base.ResolveReference(ref).String()
+		}
+	}
+	return c.responseAbsURL(link)
+}
+
+// <base href> resolved against url of response, nil if document doesn't have it
+// body which isn't html isn't parsed to find it
+func (c *Context) baseURL() *url.URL {
+	if c.baseResolved {
+		return c.base
+	}
+	c.baseResolved = true
+	contentType := responseContentType(c.cmd.response())
+	if c.doc == nil && contentType != "" && !strings.Contains(contentType, "html") {
+		return nil
+	}
+	doc, err := c.MayDoc()
+	if err != nil {
+		return nil
+	}
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return nil
+	}
+	if base, err := url.Parse(c.responseAbsURL(strings.TrimSpace(href))); err == nil {
+		c.base = base
+	}
+	return c.base
+}
+
+// link resolved against url of response
+func (c *Context) responseAbsURL(link string) string {
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+	c.cmd.downloadRequest.URI().CopyTo(uri)
+	uri.Update(link)
+	return uri.String()
+}
+
+// download and parse command again, e.g. parse failed
 func (c *Context) Retry() {
+	c.cmd.retry()
+}
+
+// response is a ban page not found by BanDetector,
+// request host is banned for downloader used and command is retried
+func (c *Context) Ban() {
 	c.cmd.beBanned()
 	c.cmd.retry()
 }
@@ -164,6 +250,41 @@ func (c *Context) checkItemType(itemType reflect.Type) bool {
 	return true
 }
 
+// body of response, not decoded
+func (c *Context) RawBody() []byte {
+	return c.cmd.response().Body()
+}
+
+// body of response decoded to utf-8
+func (c *Context) Text() string {
+	return string(c.utf8Body())
+}
+
+// charset of response body, e.g. gbk
+func (c *Context) Charset() string {
+	c.utf8Body()
+	return c.bodyCharset
+}
+
+func (c *Context) utf8Body() []byte {
+	if c.body != nil {
+		return c.body
+	}
+
+	resp := c.cmd.response()
+	body, name, err := decodeBody(resp.Body(), responseContentType(resp), c.cmd.task.charset)
+	if err != nil {
+		logrus.WithFields(c.logrusFields()).WithFields(logrus.Fields{
+			"Error":   err,
+			"Charset": name,
+		}).Warn("decode response body failed")
+		body = resp.Body()
+	}
+	c.body = body
+	c.bodyCharset = name
+	return c.body
+}
+
 func (c *Context) Doc() *goquery.Document {
 	if c.doc != nil {
 		return c.doc
@@ -182,7 +303,7 @@ func (c *Context) MayDoc() (*goquery.Document, error) {
 		return c.doc, nil
 	}
 
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(c.cmd.downloadResponse.Body()))
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(c.utf8Body()))
 	if err != nil {
 		return nil, err
 	}
@@ -220,17 +341,38 @@ func (c *Context) MayHTML(selector string, callback func(element *HTMLElement))
 
 // save link's resource to instance/[taskName].[taskID]/[fileName]
 func (c *Context) SaveResource(link string, fileName string) {
-	c.Follow(link, c.saveResourceCallback, H{
+	c.SaveResourceWithBuilder(link, fileName, c.NewFollowBuilder())
+}
+
+// resource is downloaded like other commands and written to fileName,
+// if fBuilder sets Stream, MaxSize or Checksum, resource is streamed to a part file
+// and renamed to fileName when it is complete, download is resumed from part file by Range request if it fails.
+func (c *Context) SaveResourceWithBuilder(link string, fileName string, fBuilder *FollowBuilder) {
+	fBuilder.ContextData(H{
 		"Cobweb-FileName": fileName,
 	})
+	if fBuilder.isStream() {
+		fBuilder.streamTo(fileName)
+	}
+	c.FollowWithBuilder(link, saveResourceCallback, fBuilder)
 }
 
-func (c *Context) saveResourceCallback(ctx *Context) {
+func saveResourceCallback(ctx *Context) {
+	if ctx.cmd.stream != nil && ctx.cmd.stream.tooLarge {
+		logrus.WithFields(ctx.logrusFields()).WithField("MaxSize", ctx.cmd.stream.maxSize).Warn("resource is too large, not saved")
+		return
+	}
+
 	if ctx.cmd.response().StatusCode() != 200 {
 		ctx.Retry()
 		return
 	}
 
+	if ctx.cmd.stream != nil {
+		// saved by stream download
+		return
+	}
+
 	val, ok := ctx.Get("Cobweb-FileName")
 	if !ok {
 		logrus.WithFields(ctx.logrusFields()).Error("save resource failed, Cobweb-FileName does't exist")
@@ -243,7 +385,7 @@ func (c *Context) saveResourceCallback(ctx *Context) {
 		return
 	}
 
-	filePath := path.Join(c.cmd.task.folderPath(), fileName)
+	filePath := path.Join(ctx.cmd.task.folderPath(), fileName)
 	if err := os.MkdirAll(path.Dir(filePath), os.ModeDir); err != nil {
 		logrus.WithFields(ctx.logrusFields()).WithField("Error", err).Error("save resource failed")
 		return
@@ -257,6 +399,89 @@ func (c *Context) saveResourceCallback(ctx *Context) {
 	logrus.WithField("FilePath", filePath).Info("resource saved")
 }
 
+// save media of link to media store of task, see MediaStoreConfig
+// name is a readable name of media, e.g. [title]/cover.jpg
+// media downloaded or being downloaded by task is not downloaded again,
+// Hash and Path of returned MediaRef are resolved when it's downloaded, see MediaRef
+func (c *Context) SaveMedia(link string, name string) MediaRef {
+	return c.SaveMediaWithBuilder(link, name, c.NewFollowBuilder())
+}
+
+// fBuilder sets MaxSize and Checksum of media
+func (c *Context) SaveMediaWithBuilder(link string, name string, fBuilder *FollowBuilder) MediaRef {
+	link = c.absURL(link)
+	store := c.cmd.task.media()
+	ref, download := store.reserve(link, name)
+	if !download {
+		return ref
+	}
+
+	fBuilder.ContextData(H{
+		"Cobweb-MediaURL":  link,
+		"Cobweb-MediaName": name,
+	})
+	fBuilder.streamTo(path.Join(c.cmd.task.mediaDir(), store.newTempName()))
+	// link followed by other callbacks is downloaded as media too
+	fBuilder.DontFilter()
+	c.FollowWithBuilder(link, saveMediaCallback, fBuilder)
+	return ref
+}
+
+func saveMediaCallback(ctx *Context) {
+	if ctx.cmd.stream == nil {
+		logrus.WithFields(ctx.logrusFields()).Error("save media failed, command isn't stream download")
+		return
+	}
+	if ctx.cmd.stream.tooLarge {
+		logrus.WithFields(ctx.logrusFields()).WithField("MaxSize", ctx.cmd.stream.maxSize).Warn("media is too large, not saved")
+		releaseMedia(ctx)
+		return
+	}
+	if ctx.cmd.response().StatusCode() != 200 {
+		ctx.Retry()
+		return
+	}
+
+	link, _ := ctx.Get("Cobweb-MediaURL")
+	name, _ := ctx.Get("Cobweb-MediaName")
+	linkStr, ok1 := link.(string)
+	nameStr, ok2 := name.(string)
+	if !ok1 || !ok2 {
+		logrus.WithFields(ctx.logrusFields()).Error("save media failed, Cobweb-MediaURL or Cobweb-MediaName is't string")
+		return
+	}
+
+	store := ctx.cmd.task.media()
+	tempPath := path.Join(ctx.cmd.task.folderPath(), ctx.cmd.stream.fileName)
+	ref, err := store.store(tempPath, linkStr, nameStr)
+	if err != nil {
+		logrus.WithFields(ctx.logrusFields()).WithField("Error", err).Error("save media failed")
+		store.release(linkStr)
+		return
+	}
+	// other names wanting link while it was downloaded
+	for _, other := range store.release(linkStr) {
+		if other != nameStr {
+			store.alias(linkStr, other)
+		}
+	}
+	logrus.WithFields(logrus.Fields{
+		"URL":  ref.URL,
+		"Name": ref.Name,
+		"Path": ref.Path,
+	}).Info("media saved")
+	ctx.cmd.task.processMedia(ref)
+}
+
+// link of media which isn't saved can be downloaded again
+func releaseMedia(ctx *Context) {
+	if link, ok := ctx.Get("Cobweb-MediaURL"); ok {
+		if linkStr, ok := link.(string); ok {
+			ctx.cmd.task.media().release(linkStr)
+		}
+	}
+}
+
 func (c *Context) commands() []*command {
 	return c.cmds
 }
@@ -273,6 +498,15 @@ func (c *Context) panicByHTMLParseError(err error) {
 	})
 }
 
+// callback calls method of Context with bad arguments, command fails without retry
+func (c *Context) panicByBadUsage(err error) {
+	panic(&ParseErrorInfo{
+		Ctx:        c,
+		ErrKind:    UnknownParseError,
+		PanicValue: err,
+	})
+}
+
 // want to find HTML Element or Element's attribute, but can not
 // selectRule is the rule to find it
 func (c *Context) panicByHTMLNotFound(selectRule htmlSelectRules) {
@@ -0,0 +1,316 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/net/publicsuffix"
+)
+
+type CookieJarMode int
+
+const (
+	// one cookie jar shared by all commands of task
+	CookieJarPerTask CookieJarMode = iota
+	// one cookie jar for each proxy, so every proxy keeps its own session
+	CookieJarPerProxy
+	// response cookies are thrown away
+	CookieJarDisabled
+)
+
+// cookies of responses are kept only if rule implements CookieJarRule,
+// they are saved to instance/cookies/<task name>.json and loaded by next run
+type CookieJarRule interface {
+	CookieJarMode() CookieJarMode
+}
+
+type jarCookie struct {
+	Name  string
+	Value string
+	// cookie without Domain attribute is only sent to host set it
+	Domain   string
+	HostOnly bool
+	Path     string
+	// zero if cookie is a session cookie
+	Expires time.Time
+	Secure  bool
+}
+
+func (c *jarCookie) expired(nt time.Time) bool {
+	return !c.Expires.IsZero() && !c.Expires.After(nt)
+}
+
+func (c *jarCookie) match(host, reqPath string, https bool) bool {
+	if c.Secure && !https {
+		return false
+	}
+	if c.HostOnly {
+		if host != c.Domain {
+			return false
+		}
+	} else if host != c.Domain && !strings.HasSuffix(host, "."+c.Domain) {
+		return false
+	}
+	if reqPath == "" {
+		reqPath = "/"
+	}
+	if !strings.HasPrefix(reqPath, c.Path) {
+		return false
+	}
+	return len(reqPath) == len(c.Path) || strings.HasSuffix(c.Path, "/") || reqPath[len(c.Path)] == '/'
+}
+
+func (c *jarCookie) key() string {
+	return c.Domain + ";" + c.Path + ";" + c.Name
+}
+
+// modified cookies are saved to file at most once in it
+const cookieJarSaveInterval = time.Second * 5
+
+// cookieJar stores cookies of responses and applies them to later requests
+// cookies are saved to a json file every cookieJarSaveInterval if they are modified,
+// and by flush when task finishes
+type cookieJar struct {
+	locker sync.Mutex
+	// jar key -> cookie key -> cookie
+	jars     map[string]map[string]*jarCookie
+	filePath string
+	dirty    bool
+	lastSave time.Time
+
+	// file is written without locker held
+	saveLocker sync.Mutex
+}
+
+func newCookieJar(filePath string) *cookieJar {
+	j := &cookieJar{
+		jars:     make(map[string]map[string]*jarCookie),
+		filePath: filePath,
+	}
+	if err := j.load(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":    err,
+			"FilePath": filePath,
+		}).Error("load cookie jar failed")
+	}
+	return j
+}
+
+func (j *cookieJar) load() error {
+	if j.filePath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(j.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	jars := make(map[string][]*jarCookie)
+	if err := json.Unmarshal(data, &jars); err != nil {
+		return err
+	}
+	for jarKey, cookies := range jars {
+		jar := make(map[string]*jarCookie)
+		for _, cookie := range cookies {
+			jar[cookie.key()] = cookie
+		}
+		j.jars[jarKey] = jar
+	}
+	return nil
+}
+
+// cookies to be saved, nil if they aren't modified
+// caller holds locker
+func (j *cookieJar) snapshot() map[string][]*jarCookie {
+	if j.filePath == "" || !j.dirty {
+		return nil
+	}
+	j.dirty = false
+	j.lastSave = time.Now()
+
+	nt := time.Now()
+	jars := make(map[string][]*jarCookie)
+	for jarKey, jar := range j.jars {
+		for _, cookie := range jar {
+			if !cookie.expired(nt) {
+				copied := *cookie
+				jars[jarKey] = append(jars[jarKey], &copied)
+			}
+		}
+	}
+	return jars
+}
+
+// save modified cookies at once
+func (j *cookieJar) flush() {
+	j.locker.Lock()
+	jars := j.snapshot()
+	j.locker.Unlock()
+	j.save(jars)
+}
+
+// write cookies to a temp file and rename it to filePath
+func (j *cookieJar) save(jars map[string][]*jarCookie) {
+	if jars == nil {
+		return
+	}
+	j.saveLocker.Lock()
+	defer j.saveLocker.Unlock()
+
+	err := func() error {
+		data, err := json.MarshalIndent(jars, "", "\t")
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(path.Dir(j.filePath), os.ModePerm); err != nil {
+			return err
+		}
+		tmpFilePath := j.filePath + ".tmp"
+		if err := ioutil.WriteFile(tmpFilePath, data, os.ModePerm); err != nil {
+			return err
+		}
+		return os.Rename(tmpFilePath, j.filePath)
+	}()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":    err,
+			"FilePath": j.filePath,
+		}).Error("save cookie jar failed")
+	}
+}
+
+// cookies of jar used by request uri, name -> value
+func (j *cookieJar) cookies(jarKey string, uri *fasthttp.URI) map[string]string {
+	j.locker.Lock()
+	defer j.locker.Unlock()
+
+	host := strings.ToLower(string(uri.Host()))
+	if index := strings.LastIndex(host, ":"); index != -1 {
+		host = host[:index]
+	}
+	reqPath := string(uri.Path())
+	https := string(uri.Scheme()) == "https"
+
+	nt := time.Now()
+	cookies := make(map[string]string)
+	// longer path first, like browsers
+	pathLens := make(map[string]int)
+	for cookieKey, cookie := range j.jars[jarKey] {
+		if cookie.expired(nt) {
+			delete(j.jars[jarKey], cookieKey)
+			continue
+		}
+		if !cookie.match(host, reqPath, https) {
+			continue
+		}
+		if l, ok := pathLens[cookie.Name]; ok && l > len(cookie.Path) {
+			continue
+		}
+		pathLens[cookie.Name] = len(cookie.Path)
+		cookies[cookie.Name] = cookie.Value
+	}
+	return cookies
+}
+
+// set cookies of jar to request, they replace cookies with same name
+func (j *cookieJar) apply(jarKey string, req *fasthttp.Request) {
+	for name, value := range j.cookies(jarKey, req.URI()) {
+		req.Header.SetCookie(name, value)
+	}
+}
+
+// store Set-Cookie of response to jar
+func (j *cookieJar) update(jarKey string, uri *fasthttp.URI, resp *fasthttp.Response) {
+	host := strings.ToLower(string(uri.Host()))
+	if index := strings.LastIndex(host, ":"); index != -1 {
+		host = host[:index]
+	}
+	defaultPath := string(uri.Path())
+	if index := strings.LastIndex(defaultPath, "/"); index > 0 {
+		defaultPath = defaultPath[:index]
+	} else {
+		defaultPath = "/"
+	}
+
+	nt := time.Now()
+	newCookies := make([]*jarCookie, 0)
+	resp.Header.VisitAllCookie(func(_, value []byte) {
+		c := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(c)
+		if err := c.ParseBytes(value); err != nil {
+			return
+		}
+
+		cookie := &jarCookie{
+			Name:   string(c.Key()),
+			Value:  string(c.Value()),
+			Domain: strings.TrimPrefix(strings.ToLower(string(c.Domain())), "."),
+			Path:   string(c.Path()),
+			Secure: c.Secure(),
+		}
+		if cookie.Domain != "" && isPublicSuffix(cookie.Domain) {
+			if cookie.Domain != host {
+				// cookie of a whole suffix like .com.cn is refused
+				return
+			}
+			cookie.Domain = ""
+		}
+		if cookie.Domain == "" {
+			cookie.Domain = host
+			cookie.HostOnly = true
+		} else if host != cookie.Domain && !strings.HasSuffix(host, "."+cookie.Domain) {
+			// cookie of other domain is refused
+			return
+		}
+		if cookie.Path == "" || !strings.HasPrefix(cookie.Path, "/") {
+			cookie.Path = defaultPath
+		}
+		if c.MaxAge() > 0 {
+			cookie.Expires = nt.Add(time.Duration(c.MaxAge()) * time.Second)
+		} else if c.MaxAge() < 0 {
+			cookie.Expires = nt
+		} else if expire := c.Expire(); expire != fasthttp.CookieExpireUnlimited {
+			cookie.Expires = expire
+		}
+		newCookies = append(newCookies, cookie)
+	})
+	if len(newCookies) == 0 {
+		return
+	}
+
+	j.locker.Lock()
+	jar, ok := j.jars[jarKey]
+	if !ok {
+		jar = make(map[string]*jarCookie)
+		j.jars[jarKey] = jar
+	}
+	for _, cookie := range newCookies {
+		if cookie.expired(nt) {
+			delete(jar, cookie.key())
+		} else {
+			jar[cookie.key()] = cookie
+		}
+	}
+	j.dirty = true
+	var jars map[string][]*jarCookie
+	if nt.Sub(j.lastSave) >= cookieJarSaveInterval {
+		jars = j.snapshot()
+	}
+	j.locker.Unlock()
+	j.save(jars)
+}
+
+// domain is a public suffix like com or com.cn, which is ICANN or privately managed
+func isPublicSuffix(domain string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(domain)
+	return suffix == domain
+}
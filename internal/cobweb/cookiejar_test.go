@@ -0,0 +1,88 @@
+package cobweb
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestCookieJar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-cookie")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "cookies.json")
+
+	jar := newCookieJar(filePath)
+	uri := &fasthttp.URI{}
+	uri.Parse(nil, []byte("https://www.douban.com/accounts/login"))
+	resp := &fasthttp.Response{}
+	resp.Header.Add("Set-Cookie", "sid=abc; Domain=.douban.com; Path=/")
+	resp.Header.Add("Set-Cookie", "host=1")
+	resp.Header.Add("Set-Cookie", "secure=1; Path=/; Secure")
+	resp.Header.Add("Set-Cookie", "other=1; Domain=example.com")
+	jar.update("", uri, resp)
+
+	uri.Parse(nil, []byte("http://movie.douban.com/subject/1/"))
+	assert.Equal(t, map[string]string{"sid": "abc"}, jar.cookies("", uri))
+	uri.Parse(nil, []byte("https://www.douban.com/accounts/logout"))
+	assert.Equal(t, map[string]string{"sid": "abc", "host": "1", "secure": "1"}, jar.cookies("", uri))
+	uri.Parse(nil, []byte("https://www.douban.com/"))
+	assert.Equal(t, map[string]string{"sid": "abc", "secure": "1"}, jar.cookies("", uri))
+	assert.Empty(t, jar.cookies("http://127.0.0.1:8080", uri))
+
+	req := &fasthttp.Request{}
+	req.SetRequestURI("https://www.douban.com/")
+	req.Header.SetCookie("sid", "old")
+	jar.apply("", req)
+	assert.Equal(t, "abc", string(req.Header.Cookie("sid")))
+
+	// expire sid and load jar from file
+	resp.Reset()
+	resp.Header.Add("Set-Cookie", "sid=; Domain=douban.com; Path=/; Expires=Thu, 01 Jan 1970 00:00:00 GMT")
+	jar.update("", uri, resp)
+	jar.flush()
+	jar = newCookieJar(filePath)
+	assert.Equal(t, map[string]string{"secure": "1"}, jar.cookies("", uri))
+
+	// cookies of public suffix are refused unless suffix is the host
+	resp.Reset()
+	resp.Header.Add("Set-Cookie", "suffix=1; Domain=.com.cn; Path=/")
+	uri.Parse(nil, []byte("https://www.example.com.cn/"))
+	jar.update("", uri, resp)
+	assert.Empty(t, jar.cookies("", uri))
+	resp.Reset()
+	resp.Header.Add("Set-Cookie", "suffix=1; Domain=github.io; Path=/")
+	uri.Parse(nil, []byte("https://github.io/"))
+	jar.update("", uri, resp)
+	assert.Equal(t, map[string]string{"suffix": "1"}, jar.cookies("", uri))
+	uri.Parse(nil, []byte("https://cobweb.github.io/"))
+	assert.Empty(t, jar.cookies("", uri))
+}
+
+type cookieJarTestRule struct {
+	frontierTestRule
+}
+
+func (r *cookieJarTestRule) CookieJarMode() CookieJarMode {
+	return CookieJarPerTask
+}
+
+func TestTaskCookieJarPath(t *testing.T) {
+	// every run of task loads the same session
+	task := newTaskFromRule(&cookieJarTestRule{}, NewMemoryFrontier())
+	other := newTaskFromRule(&cookieJarTestRule{}, NewMemoryFrontier())
+	assert.NotEqual(t, task.folderPath(), other.folderPath())
+	assert.Equal(t, path.Join("instance", "cookies", task.Name()+".json"), task.cookieJar.filePath)
+	assert.Equal(t, task.cookieJar.filePath, other.cookieJar.filePath)
+}
+
+// task of rule keeps cookies in memory, like a task without CookieJarRule after login
+func newInMemoryJarTask(rule BaseRule) *Task {
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	task.cookieJar = newCookieJar("")
+	return task
+}
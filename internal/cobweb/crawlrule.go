@@ -0,0 +1,200 @@
+package cobweb
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// context data key of index of link rule matched by link of command
+const linkRuleKey = "Cobweb-LinkRule"
+
+// LinkRule matches links extracted from responses of CrawlRule
+type LinkRule struct {
+	// regular expressions, link has to match one of Allow and none of Deny
+	// every link is allowed if Allow is empty
+	Allow []string
+	Deny  []string
+	// links are extracted from elements selected by Scope, the whole document if it is empty
+	Scope string
+	// parse pages of matched links, it may be nil
+	Callback OnParseCallback
+	// links of matched pages are extracted by link rules too
+	Follow bool
+
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+func (r *LinkRule) compile() error {
+	var err error
+	if r.allow, err = compilePatterns(r.Allow); err != nil {
+		return err
+	}
+	r.deny, err = compilePatterns(r.Deny)
+	return err
+}
+
+func (r *LinkRule) matches(link string) bool {
+	if len(r.allow) != 0 && !matchAny(r.allow, link) {
+		return false
+	}
+	return len(r.deny) == 0 || !matchAny(r.deny, link)
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// CrawlRule crawls a site from StartURLs by LinkRules without InitParse,
+// every link found is followed by the first link rule it matches
+type CrawlRule struct {
+	Name      string
+	StartURLs []string
+	LinkRules []LinkRule
+	// links to other domains are dropped, domain also matches subdomains
+	// every domain is allowed if it is empty
+	AllowedDomains []string
+
+	compileOnce sync.Once
+	compileErr  error
+}
+
+// CrawlRule of task's rule, rules embedding CrawlRule implement it too
+type crawlRuleHolder interface {
+	crawlRule() *CrawlRule
+}
+
+func (r *CrawlRule) crawlRule() *CrawlRule {
+	return r
+}
+
+func (r *CrawlRule) TaskName() string {
+	if r.Name == "" {
+		return "CrawlRule"
+	}
+	return r.Name
+}
+
+func (r *CrawlRule) InitLinks() []string {
+	return r.StartURLs
+}
+
+// links of start pages are always extracted
+func (r *CrawlRule) InitParse(ctx *Context) {
+	r.extractLinks(ctx)
+}
+
+// callbacks of link rules used by cluster workers
+func (r *CrawlRule) Callbacks() []OnParseCallback {
+	callbacks := make([]OnParseCallback, 0, len(r.LinkRules))
+	for _, linkRule := range r.LinkRules {
+		if linkRule.Callback != nil {
+			callbacks = append(callbacks, linkRule.Callback)
+		}
+	}
+	return callbacks
+}
+
+// patterns of link rules are compiled once, rule is rejected by task if one is invalid
+func (r *CrawlRule) compile() error {
+	r.compileOnce.Do(func() {
+		for i := range r.LinkRules {
+			if err := r.LinkRules[i].compile(); err != nil {
+				r.compileErr = fmt.Errorf("link rule %d: %v", i, err)
+				return
+			}
+		}
+	})
+	return r.compileErr
+}
+
+func (r *CrawlRule) isAllowed(link string) bool {
+	policy := RedirectPolicy{AllowedDomains: r.AllowedDomains}
+	uri := fasthttp.AcquireURI()
+	defer fasthttp.ReleaseURI(uri)
+	return uri.Parse(nil, []byte(link)) == nil && policy.isAllowed(string(uri.Host()))
+}
+
+// follow links of response matched by link rules,
+// link in scopes of several rules is followed by the first one
+func (r *CrawlRule) extractLinks(ctx *Context) {
+	doc, err := ctx.MayDoc()
+	if err != nil {
+		ctx.panicByHTMLParseError(err)
+	}
+
+	followed := make(map[string]bool)
+	for i := range r.LinkRules {
+		linkRule := &r.LinkRules[i]
+		selection := doc.Selection
+		if linkRule.Scope != "" {
+			selection = doc.Find(linkRule.Scope)
+		}
+		selection.Find("a[href], area[href]").Each(func(_ int, a *goquery.Selection) {
+			href, _ := a.Attr("href")
+			link, ok := crawlableLink(ctx, href)
+			if !ok || followed[link] || !r.isAllowed(link) || !linkRule.matches(link) {
+				return
+			}
+			followed[link] = true
+			ctx.Follow(link, crawlCallback, H{linkRuleKey: strconv.Itoa(i)})
+		})
+	}
+}
+
+var linkSchemeRegexp = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+
+// absolute link without fragment, false if it can't be downloaded
+func crawlableLink(ctx *Context, href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	if scheme := linkSchemeRegexp.FindString(href); scheme != "" {
+		scheme = strings.ToLower(scheme)
+		if scheme != "http:" && scheme != "https:" {
+			// mailto:, javascript: and so on
+			return "", false
+		}
+	}
+	link := ctx.absURL(href)
+	if index := strings.Index(link, "#"); index != -1 {
+		link = link[:index]
+	}
+	return link, true
+}
+
+// parse page of link matched by link rule of CrawlRule
+func crawlCallback(ctx *Context) {
+	holder, ok1 := ctx.cmd.task.rule.(crawlRuleHolder)
+	val, ok2 := ctx.data[linkRuleKey].(string)
+	index, err := strconv.Atoi(val)
+	if !ok1 || !ok2 || err != nil || index < 0 || index >= len(holder.crawlRule().LinkRules) {
+		logrus.WithFields(ctx.logrusFields()).Error("invalid link rule of command")
+		return
+	}
+
+	crawlRule := holder.crawlRule()
+	linkRule := &crawlRule.LinkRules[index]
+	if linkRule.Callback != nil {
+		linkRule.Callback(ctx)
+	}
+	if linkRule.Follow {
+		crawlRule.extractLinks(ctx)
+	}
+}
@@ -0,0 +1,103 @@
+package cobweb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const crawlTestPage = `<html><body>
+<div class="nav">
+	<a href="/list?page=2">next</a>
+	<a href="/item/1">item in nav</a>
+</div>
+<div class="list">
+	<a href="/item/1#comments">item</a>
+	<a href="/item/2">item</a>
+	<a href="/item/3/edit">edit</a>
+	<a href="mailto:a@a.com">mail</a>
+	<a href="javascript:void(0)">js</a>
+	<a href="http://other.com/item/4">other</a>
+</div>
+</body></html>`
+
+func TestCrawlRule(t *testing.T) {
+	parsed := 0
+	rule := &CrawlRule{
+		StartURLs:      []string{"http://a.com/"},
+		AllowedDomains: []string{"a.com"},
+		LinkRules: []LinkRule{
+			{
+				Allow:    []string{`/item/\d+`},
+				Deny:     []string{`/edit$`},
+				Scope:    ".list",
+				Callback: func(ctx *Context) { parsed++ },
+			},
+			{
+				Allow:  []string{`/list\?page=\d+`},
+				Follow: true,
+			},
+		},
+	}
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	assert.Equal(t, "CrawlRule", task.Name())
+
+	cmd := task.initCommands()[0]
+	cmd.response().SetBodyString(crawlTestPage)
+	ctx := newContext(cmd)
+	rule.InitParse(ctx)
+
+	links := make(map[string]string)
+	for _, cmd := range ctx.commands() {
+		links[cmd.request().URI().String()] = cmd.contextData[linkRuleKey].(string)
+	}
+	assert.Equal(t, map[string]string{
+		"http://a.com/item/1":      "0",
+		"http://a.com/item/2":      "0",
+		"http://a.com/list?page=2": "1",
+	}, links)
+
+	// item pages are parsed, list pages are followed
+	for _, cmd := range ctx.commands() {
+		cmd.response().SetBodyString(crawlTestPage)
+		childCtx := newContext(cmd)
+		crawlCallback(childCtx)
+		if cmd.contextData[linkRuleKey] == "0" {
+			assert.Len(t, childCtx.commands(), 0)
+		} else {
+			assert.Len(t, childCtx.commands(), 3)
+		}
+	}
+	assert.Equal(t, 2, parsed)
+
+	assert.Contains(t, task.callbacks, callbackName(rule.LinkRules[0].Callback))
+}
+
+type crawlEmbedTestRule struct {
+	CrawlRule
+}
+
+func TestCrawlRuleEmbedded(t *testing.T) {
+	parsed := 0
+	rule := &crawlEmbedTestRule{CrawlRule{
+		StartURLs: []string{"http://a.com/"},
+		LinkRules: []LinkRule{{Allow: []string{`/item/2$`}, Callback: func(ctx *Context) { parsed++ }}},
+	}}
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	assert.Nil(t, task.ruleErr)
+
+	cmd := task.initCommands()[0]
+	cmd.response().SetBodyString(crawlTestPage)
+	ctx := newContext(cmd)
+	rule.InitParse(ctx)
+	assert.Len(t, ctx.commands(), 1)
+	crawlCallback(newContext(ctx.commands()[0]))
+	assert.Equal(t, 1, parsed)
+
+	// invalid pattern rejects rule
+	task = newTaskFromRule(&CrawlRule{
+		StartURLs: []string{"http://a.com/"},
+		LinkRules: []LinkRule{{Allow: []string{`/item/(\d+`}}},
+	}, NewMemoryFrontier())
+	assert.NotNil(t, task.ruleErr)
+}
@@ -0,0 +1,378 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"gopkg.in/yaml.v3"
+)
+
+// context data key of page type of command of DeclarativeRule
+const pageTypeKey = "Cobweb-PageType"
+
+// pipelines used by name in declarative rules
+var declarativePipelines = map[string]func() Pipeline{
+	"json_file":   func() Pipeline { return &JsonFilePipeline{} },
+	"json_stdout": func() Pipeline { return &JsonStdoutPipeline{} },
+}
+
+// Selector finds nodes by CSS or XPath, only one of them can be set
+// xpath starts with // searches the whole document, use .// under scope
+type Selector struct {
+	CSS   string `yaml:"css" json:"css"`
+	XPath string `yaml:"xpath" json:"xpath"`
+
+	css   cascadia.Selector
+	xpath *xpath.Expr
+}
+
+func (s *Selector) compile() error {
+	var err error
+	switch {
+	case s.CSS != "" && s.XPath != "":
+		return errors.New("css and xpath can't be set at the same time")
+	case s.CSS != "":
+		if s.css, err = cascadia.Compile(s.CSS); err != nil {
+			return fmt.Errorf("invalid css %q: %v", s.CSS, err)
+		}
+	case s.XPath != "":
+		if s.xpath, err = xpath.Compile(s.XPath); err != nil {
+			return fmt.Errorf("invalid xpath %q: %v", s.XPath, err)
+		}
+	default:
+		return errors.New("css or xpath is required")
+	}
+	return nil
+}
+
+func (s *Selector) isEmpty() bool {
+	return s.CSS == "" && s.XPath == ""
+}
+
+// descendants of node selected
+func (s *Selector) find(node *html.Node) []*html.Node {
+	if s.xpath != nil {
+		return htmlquery.QuerySelectorAll(node, s.xpath)
+	}
+	return goquery.NewDocumentFromNode(node).FindMatcher(s.css).Nodes
+}
+
+func (s *Selector) String() string {
+	if s.XPath != "" {
+		return "xpath:" + s.XPath
+	}
+	return "css:" + s.CSS
+}
+
+// FieldExtractor extracts a field of item
+type FieldExtractor struct {
+	Selector `yaml:",inline"`
+	Name     string `yaml:"name" json:"name"`
+	// text of node is used if it is empty
+	Attr string `yaml:"attr" json:"attr"`
+	// field is []string of every node found
+	Multiple bool `yaml:"multiple" json:"multiple"`
+	// command is retried if field isn't found
+	Required bool `yaml:"required" json:"required"`
+}
+
+// FollowLink follows links found by selector and parses them as Page
+type FollowLink struct {
+	Selector `yaml:",inline"`
+	// href if it is empty
+	Attr string `yaml:"attr" json:"attr"`
+	Page string `yaml:"page" json:"page"`
+}
+
+// PageType describes how to parse a kind of page
+type PageType struct {
+	// every node found is an item, the whole page is an item if it is empty
+	Scope  Selector         `yaml:"scope" json:"scope"`
+	Fields []FieldExtractor `yaml:"fields" json:"fields"`
+	Follow []FollowLink     `yaml:"follow" json:"follow"`
+	// link of next page, it is parsed as the same page type
+	Next Selector `yaml:"next" json:"next"`
+
+	itemType reflect.Type
+}
+
+// DeclarativeRule is a rule loaded from YAML or JSON
+//
+//	name: douban
+//	start_urls: ["https://movie.douban.com/top250"]
+//	start_page: list
+//	pages:
+//	  list:
+//	    follow: [{css: "div.hd > a", page: detail}]
+//	    next: {css: "span.next > a"}
+//	  detail:
+//	    fields:
+//	      - {name: title, css: "h1 > span", required: true}
+//	      - {name: year, xpath: "//span[@class='year']"}
+//	pipelines: [json_file]
+type DeclarativeRule struct {
+	Name      string               `yaml:"name" json:"name"`
+	StartURLs []string             `yaml:"start_urls" json:"start_urls"`
+	StartPage string               `yaml:"start_page" json:"start_page"`
+	Pages     map[string]*PageType `yaml:"pages" json:"pages"`
+	Pipeline  []string             `yaml:"pipelines" json:"pipelines"`
+
+	compileOnce sync.Once
+	compileErr  error
+}
+
+// DeclarativeRule of task's rule, rules embedding DeclarativeRule implement it too
+type declarativeRuleHolder interface {
+	declarativeRule() *DeclarativeRule
+}
+
+func (r *DeclarativeRule) declarativeRule() *DeclarativeRule {
+	return r
+}
+
+// load rule from .yaml, .yml or .json file
+func LoadDeclarativeRule(filePath string) (*DeclarativeRule, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	rule := &DeclarativeRule{}
+	switch strings.ToLower(path.Ext(filePath)) {
+	case ".json":
+		err = json.Unmarshal(data, rule)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, rule)
+	default:
+		err = fmt.Errorf("unsupported rule file %s", filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := rule.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %v", filePath, err)
+	}
+	return rule, nil
+}
+
+// rule is validated and its selectors are compiled once, rule is rejected by task if it is invalid
+func (r *DeclarativeRule) compile() error {
+	r.compileOnce.Do(func() {
+		r.compileErr = r.compilePages()
+	})
+	return r.compileErr
+}
+
+func (r *DeclarativeRule) compilePages() error {
+	if len(r.StartURLs) == 0 {
+		return errors.New("start_urls is empty")
+	}
+	if _, ok := r.Pages[r.StartPage]; !ok {
+		return fmt.Errorf("start page %q doesn't exist", r.StartPage)
+	}
+	for _, name := range r.Pipeline {
+		if _, ok := declarativePipelines[name]; !ok {
+			return fmt.Errorf("unknown pipeline %q", name)
+		}
+	}
+	for name, page := range r.Pages {
+		if err := r.compilePage(page); err != nil {
+			return fmt.Errorf("page %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (r *DeclarativeRule) compilePage(page *PageType) error {
+	if !page.Scope.isEmpty() {
+		if err := page.Scope.compile(); err != nil {
+			return fmt.Errorf("scope: %v", err)
+		}
+	}
+	if !page.Next.isEmpty() {
+		if err := page.Next.compile(); err != nil {
+			return fmt.Errorf("next: %v", err)
+		}
+	}
+	for i := range page.Follow {
+		follow := &page.Follow[i]
+		if err := follow.compile(); err != nil {
+			return fmt.Errorf("follow %d: %v", i, err)
+		}
+		if _, ok := r.Pages[follow.Page]; !ok {
+			return fmt.Errorf("follow %d: page %q doesn't exist", i, follow.Page)
+		}
+	}
+
+	// item of page is a struct built from fields
+	structFields := make([]reflect.StructField, 0, len(page.Fields))
+	names := make(map[string]bool)
+	for i := range page.Fields {
+		field := &page.Fields[i]
+		if err := field.compile(); err != nil {
+			return fmt.Errorf("field %s: %v", field.Name, err)
+		}
+		goName := exportedFieldName(field.Name)
+		if goName == "" || names[goName] {
+			return fmt.Errorf("field name %q is empty or duplicated", field.Name)
+		}
+		names[goName] = true
+
+		fieldType := reflect.TypeOf("")
+		if field.Multiple {
+			fieldType = reflect.TypeOf([]string{})
+		}
+		structFields = append(structFields, reflect.StructField{
+			Name: goName,
+			Type: fieldType,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s"`, field.Name)),
+		})
+	}
+	if len(structFields) != 0 {
+		page.itemType = reflect.StructOf(structFields)
+	}
+	return nil
+}
+
+// field name -> FieldName
+func exportedFieldName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	goName := ""
+	for _, word := range words {
+		runes := []rune(word)
+		goName += string(unicode.ToUpper(runes[0])) + string(runes[1:])
+	}
+	if goName == "" {
+		return ""
+	}
+	if first := []rune(goName)[0]; !unicode.IsUpper(first) {
+		// digit or letter without case
+		goName = "F" + goName
+	}
+	return goName
+}
+
+func (r *DeclarativeRule) TaskName() string {
+	if r.Name == "" {
+		return "DeclarativeRule"
+	}
+	return r.Name
+}
+
+func (r *DeclarativeRule) InitLinks() []string {
+	return r.StartURLs
+}
+
+func (r *DeclarativeRule) InitParse(ctx *Context) {
+	r.parsePage(ctx, r.StartPage)
+}
+
+func (r *DeclarativeRule) Pipelines() []Pipeline {
+	pipelines := make([]Pipeline, 0, len(r.Pipeline))
+	for _, name := range r.Pipeline {
+		pipelines = append(pipelines, declarativePipelines[name]())
+	}
+	return pipelines
+}
+
+func (r *DeclarativeRule) parsePage(ctx *Context, pageName string) {
+	page := r.Pages[pageName]
+	doc, err := ctx.MayDoc()
+	if err != nil {
+		ctx.panicByHTMLParseError(err)
+	}
+	root := doc.Nodes[0]
+
+	if page.itemType != nil {
+		scopes := []*html.Node{root}
+		if !page.Scope.isEmpty() {
+			scopes = page.Scope.find(root)
+		}
+		for _, scope := range scopes {
+			ctx.Item(page.extractItem(ctx, scope))
+		}
+	}
+
+	for _, follow := range page.Follow {
+		r.followLinks(ctx, root, &follow.Selector, follow.Attr, follow.Page)
+	}
+	if !page.Next.isEmpty() {
+		r.followLinks(ctx, root, &page.Next, "", pageName)
+	}
+}
+
+// item of page is a pointer of struct built by compilePage
+func (p *PageType) extractItem(ctx *Context, scope *html.Node) interface{} {
+	item := reflect.New(p.itemType)
+	for i := range p.Fields {
+		field := &p.Fields[i]
+		values := make([]string, 0)
+		for _, node := range field.find(scope) {
+			if val, ok := nodeValue(node, field.Attr); ok {
+				values = append(values, val)
+			}
+		}
+		if len(values) == 0 && field.Required {
+			ctx.panicByHTMLNotFound(htmlSelectRules{}.append("selector", field.Selector.String()).append("attrname", field.Attr))
+		}
+
+		fieldValue := item.Elem().Field(i)
+		if field.Multiple {
+			fieldValue.Set(reflect.ValueOf(values))
+		} else if len(values) != 0 {
+			fieldValue.SetString(values[0])
+		}
+	}
+	return item.Interface()
+}
+
+// value of attr, trimmed text if attr is empty
+func nodeValue(node *html.Node, attr string) (string, bool) {
+	if attr != "" {
+		if !htmlquery.ExistsAttr(node, attr) {
+			return "", false
+		}
+		return htmlquery.SelectAttr(node, attr), true
+	}
+	return strings.TrimSpace(htmlquery.InnerText(node)), true
+}
+
+func (r *DeclarativeRule) followLinks(ctx *Context, root *html.Node, selector *Selector, attr string, pageName string) {
+	if attr == "" {
+		attr = "href"
+	}
+	for _, node := range selector.find(root) {
+		href, ok := nodeValue(node, attr)
+		if !ok {
+			continue
+		}
+		if link, ok := crawlableLink(ctx, href); ok {
+			ctx.Follow(link, declarativeCallback, H{pageTypeKey: pageName})
+		}
+	}
+}
+
+// parse page followed by DeclarativeRule
+func declarativeCallback(ctx *Context) {
+	holder, ok1 := ctx.cmd.task.rule.(declarativeRuleHolder)
+	pageName, ok2 := ctx.data[pageTypeKey].(string)
+	if !ok1 || !ok2 || holder.declarativeRule().Pages[pageName] == nil {
+		logrus.WithFields(ctx.logrusFields()).Error("invalid page type of command")
+		return
+	}
+	holder.declarativeRule().parsePage(ctx, pageName)
+}
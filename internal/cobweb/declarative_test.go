@@ -0,0 +1,126 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const declarativeTestRule = `
+name: movies
+start_urls: ["http://a.com/list"]
+start_page: list
+pages:
+  list:
+    scope: {css: "li.movie"}
+    fields:
+      - {name: title, css: "a", required: true}
+      - {name: movie-id, xpath: "./a/@data-id"}
+      - {name: tags, css: "span.tag", multiple: true}
+    follow:
+      - {css: "li.movie > a", page: detail}
+    next: {xpath: "//a[@class='next']"}
+  detail:
+    fields:
+      - {name: summary, css: "p.summary"}
+pipelines: [json_file]
+`
+
+const declarativeTestPage = `<html><body><ul>
+<li class="movie"><a href="/movie/1" data-id="1"> First </a><span class="tag">a</span><span class="tag">b</span></li>
+<li class="movie"><a href="/movie/2" data-id="2">Second</a></li>
+</ul><a class="next" href="/list?page=2">next</a></body></html>`
+
+func writeRuleFile(t *testing.T, dir string, name string, content string) string {
+	filePath := path.Join(dir, name)
+	assert.Nil(t, ioutil.WriteFile(filePath, []byte(content), os.ModePerm))
+	return filePath
+}
+
+func TestDeclarativeRule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-rule")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	rule, err := LoadDeclarativeRule(writeRuleFile(t, dir, "movies.yaml", declarativeTestRule))
+	assert.Nil(t, err)
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	assert.Equal(t, "movies", task.Name())
+	assert.Len(t, task.pipelines(), 1)
+
+	cmd := task.initCommands()[0]
+	cmd.response().SetBodyString(declarativeTestPage)
+	ctx := newContext(cmd)
+	rule.InitParse(ctx)
+
+	assert.Len(t, ctx.itemInfos(), 2)
+	data, err := json.Marshal(ctx.itemInfos()[0].item)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"title": "First", "movie-id": "1", "tags": ["a", "b"]}`, string(data))
+	data, err = json.Marshal(ctx.itemInfos()[1].item)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"title": "Second", "movie-id": "2", "tags": []}`, string(data))
+
+	pages := make(map[string]string)
+	for _, cmd := range ctx.commands() {
+		pages[cmd.request().URI().String()] = cmd.contextData[pageTypeKey].(string)
+	}
+	assert.Equal(t, map[string]string{
+		"http://a.com/movie/1":     "detail",
+		"http://a.com/movie/2":     "detail",
+		"http://a.com/list?page=2": "list",
+	}, pages)
+
+	detail := ctx.commands()[0]
+	detail.response().SetBodyString(`<p class="summary">good</p>`)
+	detailCtx := newContext(detail)
+	declarativeCallback(detailCtx)
+	data, err = json.Marshal(detailCtx.itemInfos()[0].item)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"summary": "good"}`, string(data))
+}
+
+func TestLoadDeclarativeRuleErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-rule")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, err = LoadDeclarativeRule(writeRuleFile(t, dir, "ok.json", `{
+		"start_urls": ["http://a.com/"],
+		"start_page": "index",
+		"pages": {"index": {"fields": [{"name": "title", "css": "title"}]}}
+	}`))
+	assert.Nil(t, err)
+
+	for name, content := range map[string]string{
+		"css.yaml":      "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a:\n    fields: [{name: t, css: 'div[['}]\n",
+		"xpath.yaml":    "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a:\n    next: {xpath: '//a[@'}\n",
+		"both.yaml":     "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a:\n    fields: [{name: t, css: a, xpath: //a}]\n",
+		"page.yaml":     "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a:\n    follow: [{css: a, page: b}]\n",
+		"field.yaml":    "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a:\n    fields: [{name: a-b, css: a}, {name: a_b, css: b}]\n",
+		"pipeline.yaml": "start_urls: [http://a.com/]\nstart_page: a\npages:\n  a: {}\npipelines: [mysql]\n",
+	} {
+		_, err := LoadDeclarativeRule(writeRuleFile(t, dir, name, content))
+		assert.NotNil(t, err, name)
+	}
+
+	// rule built in code is compiled by task, compiled rule is compiled only once
+	rule := &DeclarativeRule{
+		StartURLs: []string{"http://a.com/"},
+		StartPage: "a",
+		Pages:     map[string]*PageType{"a": {Fields: []FieldExtractor{{Name: "t", Selector: Selector{CSS: "div[["}}}}},
+	}
+	task := newTaskFromRule(rule, NewMemoryFrontier())
+	assert.NotNil(t, task.ruleErr)
+	assert.Equal(t, task.ruleErr, rule.compile())
+	rule, err = LoadDeclarativeRule(writeRuleFile(t, dir, "ok.yaml", declarativeTestRule))
+	assert.Nil(t, err)
+	itemType := rule.Pages[rule.StartPage].itemType
+	task = newTaskFromRule(rule, NewMemoryFrontier())
+	assert.Nil(t, task.ruleErr)
+	assert.Equal(t, itemType, rule.Pages[rule.StartPage].itemType)
+}
@@ -0,0 +1,154 @@
+package cobweb
+
+import (
+	"sync"
+	"time"
+)
+
+// commandDelayQueue holds commands of downloaderManager which can't be downloaded now.
+// commands throttled by limiter wait in queue of their host,
+// the head of queue is released when host has token, one at a time.
+// commands to retry later wait until their due time.
+// a single routine sends released commands back, queued ones are dropped when it stops
+type commandDelayQueue struct {
+	limiter     *hostRateLimiter
+	out         chan<- *command
+	stopChannel <-chan struct{}
+
+	locker sync.Mutex
+	hosts  map[string][]*command
+	// command released for host and not handled by download routine yet
+	released map[string]*command
+	timed    []timedCommand
+	wake     chan struct{}
+}
+
+type timedCommand struct {
+	cmd *command
+	due time.Time
+}
+
+// queue without command waits at most so long
+const commandDelayQueueIdle = time.Minute
+
+func newCommandDelayQueue(limiter *hostRateLimiter, out chan<- *command, stopChannel <-chan struct{}) *commandDelayQueue {
+	return &commandDelayQueue{
+		limiter:     limiter,
+		out:         out,
+		stopChannel: stopChannel,
+		hosts:       make(map[string][]*command),
+		released:    make(map[string]*command),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// cmd waits until host has token
+func (q *commandDelayQueue) throttle(host string, cmd *command) {
+	q.locker.Lock()
+	if q.released[host] == cmd {
+		delete(q.released, host)
+	}
+	q.hosts[host] = append(q.hosts[host], cmd)
+	q.locker.Unlock()
+	q.notify()
+}
+
+// cmd is handled by download routine, next command of host could be released
+func (q *commandDelayQueue) done(host string, cmd *command) {
+	q.locker.Lock()
+	ok := q.released[host] == cmd
+	if ok {
+		delete(q.released, host)
+	}
+	q.locker.Unlock()
+	if ok {
+		q.notify()
+	}
+}
+
+// cmd is sent back after delay
+func (q *commandDelayQueue) after(cmd *command, delay time.Duration) {
+	q.locker.Lock()
+	q.timed = append(q.timed, timedCommand{cmd: cmd, due: time.Now().Add(delay)})
+	q.locker.Unlock()
+	q.notify()
+}
+
+func (q *commandDelayQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// commands could be downloaded now and time to wait for the next one
+func (q *commandDelayQueue) due() ([]*command, time.Duration) {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	cmds := make([]*command, 0)
+	wait := commandDelayQueueIdle
+	now := time.Now()
+	timed := q.timed[:0]
+	for _, item := range q.timed {
+		if untilDue := item.due.Sub(now); untilDue > 0 {
+			if untilDue < wait {
+				wait = untilDue
+			}
+			timed = append(timed, item)
+		} else {
+			cmds = append(cmds, item.cmd)
+		}
+	}
+	for i := len(timed); i < len(q.timed); i++ {
+		q.timed[i] = timedCommand{}
+	}
+	q.timed = timed
+
+	for host, queue := range q.hosts {
+		if _, ok := q.released[host]; ok {
+			continue
+		}
+		if hostWait := q.limiter.waitTime(host); hostWait > 0 {
+			if hostWait < wait {
+				wait = hostWait
+			}
+			continue
+		}
+		cmds = append(cmds, queue[0])
+		q.released[host] = queue[0]
+		if len(queue) == 1 {
+			delete(q.hosts, host)
+		} else {
+			q.hosts[host] = queue[1:]
+		}
+	}
+	return cmds, wait
+}
+
+func (q *commandDelayQueue) run(stopWg *sync.WaitGroup) {
+	defer stopWg.Done()
+	for {
+		cmds, wait := q.due()
+		for _, cmd := range cmds {
+			select {
+			case q.out <- cmd:
+			case <-q.stopChannel:
+				return
+			}
+		}
+		if len(cmds) != 0 {
+			continue
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-q.stopChannel:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
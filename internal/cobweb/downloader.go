@@ -3,6 +3,7 @@ package cobweb
 import (
 	"errors"
 	"math"
+	"net/http"
 	"runtime"
 	"sync"
 	"time"
@@ -22,10 +23,12 @@ var downloaderDefaultReadTimeout = time.Second * 15
 
 type absDownloaderManager interface {
 	stop()
+	// error if commands can't be downloaded at all, e.g. no proxy
+	err() error
 }
 
-//
 type downloaderManager struct {
+	storage                   AbsProxyStorage
 	dFactory                  downloaderFactory
 	downloaderConcurrentLimit int
 	downloaderReqHostInterval time.Duration
@@ -33,15 +36,24 @@ type downloaderManager struct {
 	downloaderListLocker      sync.RWMutex
 	downloaderList            []*downloader
 
+	// limits requests of host sent by all downloaders,
+	// downloaders are created without their own host interval
+	limiter *hostRateLimiter
+	// throttled commands wait in it instead of inCMDChannel
+	delays *commandDelayQueue
+
 	inCMDChannel  chan *command
 	outCMDChannel chan<- *command
 
 	stopChannel chan struct{}
 	stopWg      sync.WaitGroup
 	stopOnce    sync.Once
+
+	initErr error
 }
 
 func newDownloaderManager(
+	storage AbsProxyStorage,
 	dFactory downloaderFactory,
 	downloaderCnt int,
 	downloaderConcurrentLimit int,
@@ -51,35 +63,54 @@ func newDownloaderManager(
 	outCMDChannel chan<- *command,
 ) *downloaderManager {
 	d := &downloaderManager{
+		storage:                   storage,
 		dFactory:                  dFactory,
 		downloaderConcurrentLimit: downloaderConcurrentLimit,
 		downloaderReqHostInterval: downloaderReqHostInterval,
 		downloaderErrCntLimit:     downloaderErrCntLimit,
+		limiter:                   newHostRateLimiter(downloaderReqHostInterval),
 		inCMDChannel:              inCMDChannel,
 		outCMDChannel:             outCMDChannel,
 		stopChannel:               make(chan struct{}),
 	}
+	d.delays = newCommandDelayQueue(d.limiter, d.inCMDChannel, d.stopChannel)
 
-	proxyList, err := ProxyStorageSingleton().GetTopKProxyList(downloaderCnt)
+	proxyList, err := d.storage.GetTopKProxyList(downloaderCnt)
 	if err != nil {
-		// todo
+		logrus.WithField("Error", err).Error("DownloaderManager get proxy list failed.")
 	}
 	for i := 0; i < downloaderCnt; i++ {
+		var proxy *Proxy
+		if i < len(proxyList) {
+			proxy = proxyList[i]
+		}
 		curDownloader := d.dFactory.newDownloaderWithProxy(
-			proxyList[i],
+			proxy,
 			d.downloaderConcurrentLimit,
-			d.downloaderReqHostInterval,
+			0,
 		)
-		d.downloaderList = append(d.downloaderList, curDownloader)
+		if curDownloader != nil {
+			d.downloaderList = append(d.downloaderList, curDownloader)
+		}
+	}
+	if len(d.downloaderList) == 0 {
+		d.initErr = errNoProxy
+		logrus.WithField("Error", d.initErr).Error("DownloaderManager has no downloader.")
 	}
 
 	for i := 0; i < downloaderCnt*downloaderConcurrentLimit; i++ {
 		go d.downloadRoutine(i)
 	}
+	d.stopWg.Add(1)
+	go d.delays.run(&d.stopWg)
 
 	return d
 }
 
+func (d *downloaderManager) err() error {
+	return d.initErr
+}
+
 func (d *downloaderManager) stop() {
 	d.stopOnce.Do(func() {
 		logrus.Info("DownloaderManager stopping.")
@@ -112,18 +143,25 @@ func (d *downloaderManager) downloadRoutine(routineID int) {
 				logEntry.Error("Receive nil command.")
 				continue
 			}
+			reqHost := string(cmd.request().Host())
+			if d.serveFromCache(cmd) {
+				d.delays.done(reqHost, cmd)
+				continue
+			}
+			if !d.limiter.tryAcquire(reqHost, cmd.task) {
+				d.delays.throttle(reqHost, cmd)
+				continue
+			}
+			d.delays.done(reqHost, cmd)
 			success := d.download(cmd)
 			if success {
-				d.outCMDChannel <- cmd
+				d.checkRetryPolicy(cmd)
 			} else {
-				go func() {
-					if cmd.isUnderFailCntLimit() {
-						time.Sleep(d.downloaderReqHostInterval)
-						d.inCMDChannel <- cmd
-					} else {
-						cmd.task.recordFailedCommand(cmd)
-					}
-				}()
+				if cmd.isUnderFailCntLimit() {
+					d.delays.after(cmd, d.downloaderReqHostInterval)
+				} else {
+					cmd.task.recordFailedCommand(cmd)
+				}
 			}
 
 		case <-d.stopChannel:
@@ -132,6 +170,48 @@ func (d *downloaderManager) downloadRoutine(routineID int) {
 	}
 }
 
+// fresh response of http cache is sent to parse stage directly,
+// it takes no token of limiter and no downloader, download is started only if cache isn't fresh
+func (d *downloaderManager) serveFromCache(cmd *command) bool {
+	if cmd.task.httpCache == nil || cmd.stream != nil {
+		return false
+	}
+	cmd.resetRequest()
+	if !serveFreshCache(cmd) {
+		return false
+	}
+	cmd.downloadFinish(nil)
+	if !cmd.isDownloadValid() {
+		return false
+	}
+	logrus.WithFields(cmd.logrusFields()).Info("finish download from http cache")
+	d.outCMDChannel <- cmd
+	return true
+}
+
+// send downloaded command to parse stage,
+// or back to inCMDChannel by delay queue if its response should be retried
+func (d *downloaderManager) checkRetryPolicy(cmd *command) {
+	decision, delay := cmd.task.retryPolicy.decide(cmd)
+	switch decision {
+	case retryDecisionPass:
+		d.outCMDChannel <- cmd
+
+	case retryDecisionRetry:
+		logrus.WithFields(cmd.logrusFields()).WithField("RetryDelay", delay).Info("retry command by retry policy")
+		if cmd.task.retryPolicy.HonourRetryAfter && len(cmd.response().Header.Peek("Retry-After")) != 0 {
+			// every downloader waits for host
+			d.limiter.pause(string(cmd.request().Host()), delay)
+		}
+		d.delays.after(cmd, delay)
+
+	case retryDecisionGiveUp:
+		cmd.task.recordFailedCommand(cmd)
+	}
+}
+
+// download cmd after token of its host is taken from limiter,
+// token is refunded if no downloader could be used
 func (d *downloaderManager) download(cmd *command) bool {
 	var (
 		lastIndex                      = -1
@@ -139,6 +219,7 @@ func (d *downloaderManager) download(cmd *command) bool {
 		bannedCount                    = 0
 		acquiredDownloader *downloader = nil
 		success                        = false
+		reqHost                        = string(cmd.request().Host())
 	)
 
 	// find downloader can use
@@ -163,10 +244,26 @@ func (d *downloaderManager) download(cmd *command) bool {
 		d.cleanDownloaderList(cmd)
 	}
 
-	if acquiredDownloader != nil {
+	if acquiredDownloader == nil {
+		d.limiter.refund(reqHost)
+	} else {
 		cmd.downloaderUsed = acquiredDownloader
+		startTime := time.Now()
 		err := acquiredDownloader.download(cmd)
+		if !cmd.cacheHit {
+			d.limiter.observe(reqHost, cmd.task, time.Since(startTime), cmd.response().StatusCode(), cmd.downloadError)
+		}
 		if err == nil {
+			if reason := cmd.task.detectBan(cmd); reason != "" {
+				d.banned(cmd, acquiredDownloader, reason)
+				return false
+			}
+			if cmd.task.auth != nil && cmd.task.auth.isLoggedOut(cmd) {
+				// download again with new session
+				cmd.downloadFailedCount++
+				cmd.task.auth.reauthenticate(cmd.authGeneration)
+				return false
+			}
 			logrus.WithFields(cmd.logrusFields()).WithFields(acquiredDownloader.logrusFields()).WithFields(logrus.Fields{
 				"LastIndex": lastIndex,
 			}).Info("finish download")
@@ -182,6 +279,22 @@ func (d *downloaderManager) download(cmd *command) bool {
 	return success
 }
 
+// response of cmd downloaded by bannedDownloader is banned
+// ban counts as download failure of cmd and lowers proxy score,
+// it never counts as parse failure
+func (d *downloaderManager) banned(cmd *command, bannedDownloader *downloader, reason string) {
+	cmd.downloadFailedCount++
+	bannedDownloader.beBaned(cmd)
+	cmd.task.recordBannedCommand(cmd, reason)
+
+	if proxy := bannedDownloader.proxy(); proxy != nil {
+		err := d.storage.DeactivateProxy(proxy)
+		if err != nil {
+			logrus.WithFields(bannedDownloader.logrusFields()).WithField("Error", err).Error("deactivate banned proxy failed")
+		}
+	}
+}
+
 func (d *downloaderManager) cleanDownloaderList(cmd *command) {
 	d.downloaderListLocker.Lock()
 	defer d.downloaderListLocker.Unlock()
@@ -203,7 +316,7 @@ func (d *downloaderManager) cleanDownloaderList(cmd *command) {
 		proxyUsedList = append(proxyUsedList, d2.proxy())
 	}
 
-	newProxyList, err := ProxyStorageSingleton().GetProxyListWithRefuseList(proxyUsedList, len(badDownloaderList))
+	newProxyList, err := d.storage.GetProxyListWithRefuseList(proxyUsedList, len(badDownloaderList))
 	if err != nil {
 		// todo
 	}
@@ -216,7 +329,7 @@ func (d *downloaderManager) cleanDownloaderList(cmd *command) {
 				break
 			}
 		}
-		err := ProxyStorageSingleton().DeactivateProxy(badDownloader.proxy())
+		err := d.storage.DeactivateProxy(badDownloader.proxy())
 		if err != nil {
 			// todo
 		}
@@ -224,8 +337,10 @@ func (d *downloaderManager) cleanDownloaderList(cmd *command) {
 	}
 
 	for _, proxy := range newProxyList {
-		newDownloader := d.dFactory.newDownloaderWithProxy(proxy, d.downloaderConcurrentLimit, d.downloaderReqHostInterval)
-		d.downloaderList = append(d.downloaderList, newDownloader)
+		newDownloader := d.dFactory.newDownloaderWithProxy(proxy, d.downloaderConcurrentLimit, 0)
+		if newDownloader != nil {
+			d.downloaderList = append(d.downloaderList, newDownloader)
+		}
 	}
 
 }
@@ -257,14 +372,13 @@ func (d *downloaderManager) replace(oldDownloader *downloader, reason string) {
 		return
 	}
 
-	newDownloader := d.dFactory.newDownloader(proxyList, d.downloaderConcurrentLimit, d.downloaderReqHostInterval)
+	newDownloader := d.dFactory.newDownloader(d.storage, proxyList, d.downloaderConcurrentLimit, 0)
+	d.downloaderList = append(d.downloaderList[:oldDownloaderIndex], d.downloaderList[oldDownloaderIndex+1:]...)
 	if newDownloader != nil {
-		// todo
+		d.downloaderList = append(d.downloaderList, newDownloader)
 	}
-	d.downloaderList = append(d.downloaderList[:oldDownloaderIndex], d.downloaderList[oldDownloaderIndex+1:]...)
-	d.downloaderList = append(d.downloaderList, newDownloader)
 
-	err := ProxyStorageSingleton().DeactivateProxy(oldDownloader.proxy())
+	err := d.storage.DeactivateProxy(oldDownloader.proxy())
 	if err != nil {
 		// todo
 	}
@@ -281,11 +395,13 @@ var (
 	downloadErrHostBanned      = errors.New("request host ban downloader")
 	downloadErrConcurrentLimit = errors.New("downloader are running too many requesting")
 	downloadErrRequestError    = errors.New("downloader has requested resource, but failed")
+	errNoProxy                 = errors.New("proxy storage has no proxy, use NoProxyFastHTTPDownloaderFactory to download without proxy")
 )
 
+// downloader is nil if it can't be created, e.g. proxy factory without proxy
 type downloaderFactory interface {
 	newDownloaderWithProxy(proxy *Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader
-	newDownloader(proxiesRefuse []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader
+	newDownloader(storage AbsProxyStorage, proxiesRefuse []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader
 }
 
 type NoProxyFastHTTPDownloaderFactory struct {
@@ -295,23 +411,29 @@ func (f *NoProxyFastHTTPDownloaderFactory) newDownloaderWithProxy(proxy *Proxy,
 	return newDownloader(nil, concurrentLimit, hostReqInterval)
 }
 
-func (f *NoProxyFastHTTPDownloaderFactory) newDownloader(_ []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader {
+func (f *NoProxyFastHTTPDownloaderFactory) newDownloader(_ AbsProxyStorage, _ []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader {
 	return newDownloader(nil, concurrentLimit, hostReqInterval)
 }
 
+// ProxyFastHTTPDownloaderFactory never downloads directly,
+// no downloader is created without proxy
 type ProxyFastHTTPDownloaderFactory struct {
 }
 
 func (f *ProxyFastHTTPDownloaderFactory) newDownloaderWithProxy(proxy *Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader {
+	if proxy == nil {
+		return nil
+	}
 	return newDownloader(proxy, concurrentLimit, hostReqInterval)
 }
 
-func (f *ProxyFastHTTPDownloaderFactory) newDownloader(proxiesRefuse []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader {
-	proxy, err := ProxyStorageSingleton().GetRandProxyWithRefuseList(proxiesRefuse)
+func (f *ProxyFastHTTPDownloaderFactory) newDownloader(storage AbsProxyStorage, proxiesRefuse []*Proxy, concurrentLimit int, hostReqInterval time.Duration) *downloader {
+	proxy, err := storage.GetRandProxyWithRefuseList(proxiesRefuse)
 	if err != nil {
-		// todo
+		logrus.WithField("Error", err).Error("get proxy for new downloader failed")
+		return nil
 	}
-	return newDownloader(proxy, concurrentLimit, hostReqInterval)
+	return f.newDownloaderWithProxy(proxy, concurrentLimit, hostReqInterval)
 }
 
 type downloader struct {
@@ -341,6 +463,8 @@ func (wrapper *downloader) fin() {
 type fastHTTPDownloader struct {
 	client    *fasthttp.Client
 	proxyUsed *Proxy
+	// client of stream download
+	streamClient *http.Client
 
 	reqSemaphore    *utils.Semaphore
 	concurrentLimit int
@@ -382,6 +506,7 @@ func newFastHTTPDownloader(
 		d.client = &fasthttp.Client{Dial: d.proxyUsed.FastHTTPDialHTTPProxy()}
 	}
 	d.client.ReadTimeout = downloaderDefaultReadTimeout
+	d.streamClient = newStreamClient(d.proxyUsed)
 
 	d.refreshCron.AddFunc("*/5 * * * *", d.refreshHostInfo)
 	d.refreshCron.Start()
@@ -430,6 +555,11 @@ func (d *fastHTTPDownloader) tryAcquire(cmd *command, errCntLimit int) error {
 		return downloadErrConcurrentLimit
 	}
 
+	if d.hostReqInterval <= 0 {
+		// host interval is enforced by limiter of downloaderManager
+		return nil
+	}
+
 	d.reqTimeLocker.Lock()
 	defer d.reqTimeLocker.Unlock()
 
@@ -483,7 +613,13 @@ func (d *fastHTTPDownloader) download(cmd *command) error {
 	// start download
 	//err := d.client.DoRedirects(cmd.request(), cmd.response(), 1)
 	//d.client.GetTimeout()
-	err := d.client.DoTimeout(cmd.request(), cmd.response(), cmd.timeout())
+	cmd.downloadStart(d.proxyUsed)
+	var err error
+	if cmd.stream != nil {
+		err = streamDownload(d.streamClient, cmd)
+	} else {
+		err = doCachedRedirects(d.client, cmd)
+	}
 	cmd.downloadFinish(err)
 
 	// command check download result valid
@@ -505,6 +641,7 @@ func (d *fastHTTPDownloader) download(cmd *command) error {
 }
 
 type simpleDownloaderManager struct {
+	storage             AbsProxyStorage
 	concurrentLimit     int
 	concurrentSemaphore *utils.Semaphore
 
@@ -517,11 +654,13 @@ type simpleDownloaderManager struct {
 }
 
 func newSimpleDownloaderManager(
+	storage AbsProxyStorage,
 	inCMDChannel chan *command,
 	outCMDChannel chan *command,
 	concurrentLimit int,
 ) *simpleDownloaderManager {
 	d := &simpleDownloaderManager{
+		storage:             storage,
 		concurrentLimit:     concurrentLimit,
 		concurrentSemaphore: utils.NewSemaphore(concurrentLimit),
 		inCMDChannel:        inCMDChannel,
@@ -533,6 +672,10 @@ func newSimpleDownloaderManager(
 	return d
 }
 
+func (d *simpleDownloaderManager) err() error {
+	return nil
+}
+
 func (d *simpleDownloaderManager) stop() {
 	d.stopOnce.Do(func() {
 		close(d.stopChannel)
@@ -568,7 +711,7 @@ func (d *simpleDownloaderManager) download(cmd *command) {
 		d.concurrentSemaphore.Release()
 	}()
 
-	proxy, err := ProxyStorageSingleton().GetRandTopKProxy(20)
+	proxy, err := d.storage.GetRandTopKProxy(20)
 	if err != nil || proxy == nil {
 		// todo
 		return
@@ -576,13 +719,18 @@ func (d *simpleDownloaderManager) download(cmd *command) {
 	client := fasthttp.Client{
 		Dial: proxy.FastHTTPDialHTTPProxy(),
 	}
-	err = client.DoTimeout(cmd.request(), cmd.response(), cmd.timeout())
+	cmd.downloadStart(proxy)
+	if cmd.stream != nil {
+		err = streamDownload(newStreamClient(proxy), cmd)
+	} else {
+		err = doCachedRedirects(&client, cmd)
+	}
 	cmd.downloadFinish(err)
 	if cmd.isDownloadValid() {
 		logrus.WithFields(cmd.logrusFields()).WithFields(logrus.Fields{
 			"Proxy": proxy,
 		}).Info("Finish one cmd download")
-		err := ProxyStorageSingleton().ActivateProxy(proxy)
+		err := d.storage.ActivateProxy(proxy)
 		if err != nil {
 
 		}
@@ -591,7 +739,7 @@ func (d *simpleDownloaderManager) download(cmd *command) {
 		//logrus.WithFields(cmd.logrusFields()).WithFields(logrus.Fields{
 		//	"Proxy": proxy,
 		//}).Info("Failed one cmd download")
-		err := ProxyStorageSingleton().DeactivateProxy(proxy)
+		err := d.storage.DeactivateProxy(proxy)
 		if err != nil {
 
 		}
@@ -1,27 +1,48 @@
 package cobweb
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/rs/xid"
+
 	"github.com/sirupsen/logrus"
 )
 
+// spec of unknown task or callback waits for it before pushed back,
+// so executors which know it may pop it
+const unknownSpecRequeueDelay = time.Second
+
 // Executor is a main part of cobweb
 // it accepts rule and creates task according to that.
 //
 //
 type Executor struct {
+	storage   AbsProxyStorage
+	frontier  Frontier
 	dManager  absDownloaderManager
 	parser    *parser
 	pipeliner *pipeliner
 
+	tasksLocker sync.RWMutex
+	tasks       map[string]*Task
+	// rules registered by RegisterRule, key is task name
+	rules map[string]BaseRule
+	// create task for rule, cluster worker replaces it
+	newTask func(rule BaseRule, id xid.ID) *Task
+
+	// new commands are deduped and pushed to frontier from scheduleCMDChannel
+	// commands popped from frontier are sent to downloadCMDChannel
+	scheduleCMDChannel  chan *command
 	downloadCMDChannel  chan *command
 	parseCMDChannel     chan *command
 	pipeItemInfoChannel chan *itemInfo
 
-	stopOnce sync.Once
-	stopWg   sync.WaitGroup
+	stopOnce       sync.Once
+	stopWg         sync.WaitGroup
+	stopChannel    chan struct{}
+	frontierStopWg sync.WaitGroup
 
 	runningLocker sync.Mutex
 	running       bool
@@ -29,6 +50,8 @@ type Executor struct {
 
 func NewNoProxyDefaultExecutor() *Executor {
 	return NewExecutor(
+		NewMemoryProxyStorage(),
+		NewMemoryFrontier(),
 		&NoProxyFastHTTPDownloaderFactory{},
 		1,
 		20,
@@ -37,8 +60,16 @@ func NewNoProxyDefaultExecutor() *Executor {
 	)
 }
 
-func NewDefaultExecutor() *Executor {
+func NewDefaultExecutor(storage AbsProxyStorage) *Executor {
+	return NewDefaultExecutorWithFrontier(storage, NewMemoryFrontier())
+}
+
+// executors with the same shared frontier, e.g. NewRedisFrontier, could run one task together
+// one executor accepts rule, others join the task by Executor.JoinTask
+func NewDefaultExecutorWithFrontier(storage AbsProxyStorage, frontier Frontier) *Executor {
 	return NewExecutor(
+		storage,
+		frontier,
 		&ProxyFastHTTPDownloaderFactory{},
 		100,
 		2,
@@ -48,6 +79,8 @@ func NewDefaultExecutor() *Executor {
 }
 
 func NewExecutor(
+	storage AbsProxyStorage,
+	frontier Frontier,
 	dFactory downloaderFactory,
 	downloaderCnt int,
 	downloaderConcurrentLimit int,
@@ -55,12 +88,18 @@ func NewExecutor(
 	downloaderReqHostInterval time.Duration,
 ) *Executor {
 	e := &Executor{
+		storage:             storage,
+		frontier:            frontier,
+		tasks:               make(map[string]*Task),
+		scheduleCMDChannel:  make(chan *command, 500),
 		downloadCMDChannel:  make(chan *command, 500),
 		parseCMDChannel:     make(chan *command, 500),
 		pipeItemInfoChannel: make(chan *itemInfo, 500),
+		stopChannel:         make(chan struct{}),
 	}
 
 	e.dManager = newDownloaderManager(
+		e.storage,
 		dFactory,
 		downloaderCnt,
 		downloaderConcurrentLimit,
@@ -70,50 +109,101 @@ func NewExecutor(
 		e.parseCMDChannel,
 	)
 
-	e.parser = newParser(e.parseCMDChannel, e.downloadCMDChannel, e.pipeItemInfoChannel)
+	e.parser = newParser(e.parseCMDChannel, e.scheduleCMDChannel, e.pipeItemInfoChannel)
 	e.pipeliner = newPipeliner(e.pipeItemInfoChannel)
+	e.newTask = e.defaultNewTask
+	e.startFrontierRoutines()
 	e.running = true
 
 	return e
 }
 
-func NewExecutorWithSimpleDownloaderManager() *Executor {
+func NewExecutorWithSimpleDownloaderManager(storage AbsProxyStorage) *Executor {
 	e := &Executor{
+		storage:             storage,
+		frontier:            NewMemoryFrontier(),
+		tasks:               make(map[string]*Task),
+		scheduleCMDChannel:  make(chan *command, 100),
 		downloadCMDChannel:  make(chan *command, 100),
 		parseCMDChannel:     make(chan *command, 100),
 		pipeItemInfoChannel: make(chan *itemInfo, 100),
+		stopChannel:         make(chan struct{}),
 	}
 
 	e.dManager = newSimpleDownloaderManager(
+		e.storage,
 		e.downloadCMDChannel,
 		e.parseCMDChannel,
 		200,
 	)
 
-	e.parser = newParser(e.parseCMDChannel, e.downloadCMDChannel, e.pipeItemInfoChannel)
+	e.parser = newParser(e.parseCMDChannel, e.scheduleCMDChannel, e.pipeItemInfoChannel)
 	e.pipeliner = newPipeliner(e.pipeItemInfoChannel)
+	e.newTask = e.defaultNewTask
+	e.startFrontierRoutines()
 	e.running = true
 
 	return e
 }
 
+func (e *Executor) defaultNewTask(rule BaseRule, id xid.ID) *Task {
+	return newTaskWithID(rule, e.frontier, id)
+}
+
+func (e *Executor) startFrontierRoutines() {
+	e.frontierStopWg.Add(2)
+	go e.scheduleRoutine()
+	go e.feedRoutine()
+}
+
+// proxy storage used by executor's downloaders
+func (e *Executor) ProxyStorage() AbsProxyStorage {
+	return e.storage
+}
+
 // accept rule and create task for it
-// if executor is not running return nil
+// return nil if executor is not running or rule is invalid
 func (e *Executor) AcceptRule(rule BaseRule) *Task {
 	e.runningLocker.Lock()
-	defer e.runningLocker.Unlock()
-	if !e.running {
+	running := e.running
+	e.runningLocker.Unlock()
+	if !running {
+		return nil
+	}
+
+	if err := e.dManager.err(); err != nil {
+		logrus.WithField("Error", err).Error("Cobweb reject rule, no downloader.")
 		return nil
 	}
 
-	task := newTaskFromRule(rule)
+	task := e.newTask(rule, xid.New())
 	if task == nil {
 		return nil
 	}
+	if task.ruleErr != nil {
+		logrus.WithFields(task.logrusFields()).WithField("Error", task.ruleErr).Error("Cobweb reject rule, invalid rule.")
+		return nil
+	}
+
+	// login may send several requests, so it runs without runningLocker held
+	// and doesn't block Stop and other rules
+	if err := task.authenticate(); err != nil {
+		logrus.WithFields(task.logrusFields()).WithField("Error", err).Error("Cobweb reject rule, authenticate failed.")
+		task.finish()
+		return task
+	}
+
+	e.runningLocker.Lock()
+	defer e.runningLocker.Unlock()
+	if !e.running {
+		task.finish()
+		return nil
+	}
+	e.addTask(task)
 
 	initCMDs := task.initCommands()
 	for _, cmd := range initCMDs {
-		e.downloadCMDChannel <- cmd
+		e.schedule(cmd)
 	}
 	logrus.WithFields(logrus.Fields{
 		"TaskName":     task.Name(),
@@ -122,6 +212,202 @@ func (e *Executor) AcceptRule(rule BaseRule) *Task {
 	return task
 }
 
+// join task accepted by another executor sharing the same frontier
+// rule has to be the same as the one accepted
+func (e *Executor) JoinTask(rule BaseRule, taskID string) (*Task, error) {
+	e.runningLocker.Lock()
+	defer e.runningLocker.Unlock()
+	if !e.running {
+		return nil, fmt.Errorf("executor is not running")
+	}
+	if err := e.dManager.err(); err != nil {
+		return nil, err
+	}
+
+	id, err := xid.FromString(taskID)
+	if err != nil {
+		return nil, err
+	}
+
+	task := e.newTask(rule, id)
+	if task.ruleErr != nil {
+		return nil, task.ruleErr
+	}
+	e.addTask(task)
+
+	logrus.WithFields(task.logrusFields()).Info("Cobweb join task.")
+	return task, nil
+}
+
+// register rule, so executor joins task of rule automatically
+// when it pops command of the task from shared frontier
+// invalid rule isn't registered
+func (e *Executor) RegisterRule(rule BaseRule) error {
+	if err := validateRule(rule); err != nil {
+		return err
+	}
+	e.tasksLocker.Lock()
+	defer e.tasksLocker.Unlock()
+	if e.rules == nil {
+		e.rules = make(map[string]BaseRule)
+	}
+	e.rules[ruleName(rule)] = rule
+	return nil
+}
+
+// find task by id, join it if its rule is registered
+func (e *Executor) taskOfSpec(spec *CommandSpec) *Task {
+	if task := e.taskByID(spec.TaskID); task != nil {
+		return task
+	}
+
+	e.tasksLocker.RLock()
+	rule, ok := e.rules[spec.TaskName]
+	e.tasksLocker.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	task, err := e.JoinTask(rule, spec.TaskID)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":  err,
+			"TaskID": spec.TaskID,
+		}).Error("join task failed")
+		return nil
+	}
+	return task
+}
+
+func (e *Executor) addTask(task *Task) {
+	e.tasksLocker.Lock()
+	defer e.tasksLocker.Unlock()
+	e.tasks[task.ID()] = task
+}
+
+func (e *Executor) taskByID(taskID string) *Task {
+	e.tasksLocker.RLock()
+	defer e.tasksLocker.RUnlock()
+	return e.tasks[taskID]
+}
+
+// dedup command and push it to frontier
+func (e *Executor) schedule(cmd *command) {
+	scheduleCommand(e.frontier, cmd)
+}
+
+func scheduleCommand(frontier Frontier, cmd *command) {
+	spec := newCommandSpec(cmd)
+	if !cmd.dontFilter && !cmd.seen {
+		added, err := frontier.AddSeen(spec.TaskID, spec.fingerprint())
+		if err != nil {
+			logrus.WithFields(cmd.logrusFields()).WithField("Error", err).Error("frontier dedup failed")
+		} else if !added {
+			cmd.task.recordDroppedCommand(cmd)
+			return
+		}
+		cmd.seen = true
+		spec.Seen = true
+	}
+
+	if err := frontier.Push(spec); err != nil {
+		logrus.WithFields(cmd.logrusFields()).WithField("Error", err).Error("push command to frontier failed")
+		cmd.task.recordFailedCommand(cmd)
+	}
+}
+
+// recv new command from scheduleCMDChannel and push it to frontier
+func (e *Executor) scheduleRoutine() {
+	defer e.frontierStopWg.Done()
+
+	var loop = true
+	for loop {
+		select {
+		case cmd := <-e.scheduleCMDChannel:
+			if cmd == nil {
+				continue
+			}
+			e.schedule(cmd)
+		case <-e.stopChannel:
+			loop = false
+		}
+	}
+}
+
+// pop command from frontier and send it to downloadCMDChannel
+func (e *Executor) feedRoutine() {
+	defer e.frontierStopWg.Done()
+
+	for {
+		select {
+		case <-e.stopChannel:
+			return
+		default:
+		}
+
+		spec, err := e.frontier.Pop(time.Second)
+		if err != nil {
+			logrus.WithField("Error", err).Error("pop command from frontier failed")
+			time.Sleep(time.Second)
+			continue
+		} else if spec == nil {
+			continue
+		}
+
+		cmd := e.commandFromSpec(spec)
+		if cmd == nil {
+			continue
+		}
+
+		select {
+		case e.downloadCMDChannel <- cmd:
+		case <-e.stopChannel:
+			return
+		}
+	}
+}
+
+// create command from spec popped from frontier
+// spec of unknown task or callback is pushed back for other executors
+func (e *Executor) commandFromSpec(spec *CommandSpec) *command {
+	task := e.taskOfSpec(spec)
+	var cmd *command
+	if task != nil {
+		cmd = newCommandFromSpec(task, spec)
+	}
+	if cmd != nil {
+		return cmd
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"TaskID":   spec.TaskID,
+		"URL":      spec.URL,
+		"Callback": spec.Callback,
+	}).Warn("unknown task or callback of command, push it back to frontier")
+	e.frontierStopWg.Add(1)
+	go e.requeueSpec(spec)
+	return nil
+}
+
+// push spec back after unknownSpecRequeueDelay without blocking feedRoutine,
+// it is pushed back at once if executor stops
+func (e *Executor) requeueSpec(spec *CommandSpec) {
+	defer e.frontierStopWg.Done()
+
+	timer := time.NewTimer(unknownSpecRequeueDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-e.stopChannel:
+	}
+
+	if err := e.frontier.Push(spec); err != nil {
+		logrus.WithField("Error", err).Error("push command to frontier failed")
+	} else if err := e.frontier.Ack(spec); err != nil {
+		logrus.WithField("Error", err).Error("ack command failed")
+	}
+}
+
 func (e *Executor) Stop() {
 	e.runningLocker.Lock()
 	defer e.runningLocker.Unlock()
@@ -133,6 +419,10 @@ func (e *Executor) Stop() {
 	e.stopOnce.Do(func() {
 		logrus.Info("Cobweb executor stopping...")
 
+		close(e.stopChannel)
+		e.frontierStopWg.Wait()
+
+		go e.dropCommandUntilClosed(e.scheduleCMDChannel, "ScheduleCMDChannel")
 		go e.dropCommandUntilClosed(e.downloadCMDChannel, "DownloadCMDChannel")
 		go e.dropCommandUntilClosed(e.parseCMDChannel, "ParseCMDChannel")
 		go e.dropItemInfoUntilChannelClosed(e.pipeItemInfoChannel, "PipeItemInfoChannel")
@@ -141,6 +431,7 @@ func (e *Executor) Stop() {
 		e.parser.stop()
 		e.pipeliner.stop()
 
+		close(e.scheduleCMDChannel)
 		close(e.downloadCMDChannel)
 		close(e.parseCMDChannel)
 		close(e.pipeItemInfoChannel)
@@ -0,0 +1,284 @@
+package cobweb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// context data key of entry followed by FollowFeedEntries
+const feedEntryKey = "Cobweb-FeedEntry"
+
+type FeedEntry struct {
+	Title string
+	Link  string
+	// guid of RSS or id of Atom, Link if feed doesn't have it
+	GUID string
+	// zero if feed doesn't have it
+	Published time.Time
+	// content:encoded or description of RSS, content or summary of Atom, xhtml of Atom is kept as markup
+	Content string
+}
+
+type Feed struct {
+	Title   string
+	Link    string
+	Entries []FeedEntry
+}
+
+var errUnknownFeed = errors.New("body is neither RSS nor Atom")
+
+type rssDocument struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Link  string    `xml:"link"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	PubDate     string `xml:"pubDate"`
+	Date        string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomDocument struct {
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	ID        string     `xml:"id"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+	Content   atomText   `xml:"content"`
+	Summary   atomText   `xml:"summary"`
+}
+
+// text construct of Atom, markup of xhtml is kept
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Inner string `xml:",innerxml"`
+	Text  string `xml:",chardata"`
+}
+
+func (t atomText) String() string {
+	if t.Type == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return t.Text
+}
+
+// alternate link of Atom, the first link if there isn't one
+func (e atomEntry) link() string {
+	return atomAlternateLink(e.Links)
+}
+
+func atomAlternateLink(links []atomLink) string {
+	for _, link := range links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			return link.Href
+		}
+	}
+	if len(links) != 0 {
+		return links[0].Href
+	}
+	return ""
+}
+
+// date formats used by RSS and Atom
+var feedTimeLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseFeedTime(val string) time.Time {
+	val = strings.TrimSpace(val)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// name of root element of xml body
+func feedRootName(body []byte) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local, nil
+		}
+	}
+}
+
+func parseFeed(body []byte) (*Feed, error) {
+	root, err := feedRootName(body)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.CharsetReader = charset.NewReaderLabel
+	switch root {
+	case "rss":
+		doc := &rssDocument{}
+		if err := decoder.Decode(doc); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(doc.Channel.Title), Link: strings.TrimSpace(doc.Channel.Link)}
+		for _, item := range doc.Channel.Items {
+			entry := FeedEntry{
+				Title:     strings.TrimSpace(item.Title),
+				Link:      strings.TrimSpace(item.Link),
+				GUID:      strings.TrimSpace(item.GUID),
+				Published: parseFeedTime(item.PubDate),
+				Content:   item.Encoded,
+			}
+			if entry.Published.IsZero() {
+				entry.Published = parseFeedTime(item.Date)
+			}
+			if entry.Content == "" {
+				entry.Content = item.Description
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		return feed, nil
+	case "feed":
+		doc := &atomDocument{}
+		if err := decoder.Decode(doc); err != nil {
+			return nil, err
+		}
+		feed := &Feed{Title: strings.TrimSpace(doc.Title), Link: atomAlternateLink(doc.Links)}
+		for _, item := range doc.Entries {
+			entry := FeedEntry{
+				Title:     strings.TrimSpace(item.Title),
+				Link:      strings.TrimSpace(item.link()),
+				GUID:      strings.TrimSpace(item.ID),
+				Published: parseFeedTime(item.Published),
+				Content:   item.Content.String(),
+			}
+			if entry.Published.IsZero() {
+				entry.Published = parseFeedTime(item.Updated)
+			}
+			if entry.Content == "" {
+				entry.Content = item.Summary.String()
+			}
+			feed.Entries = append(feed.Entries, entry)
+		}
+		return feed, nil
+	default:
+		return nil, errUnknownFeed
+	}
+}
+
+// parse body as RSS 2.0 or Atom, panic with ParseFeedError if it is malformed
+func (c *Context) Feed() *Feed {
+	feed, err := c.MayFeed()
+	if err != nil {
+		panic(&ParseErrorInfo{
+			Ctx:        c,
+			ErrKind:    ParseFeedError,
+			PanicValue: err,
+		})
+	}
+	return feed
+}
+
+// relative links of feed are resolved against FinalURL
+func (c *Context) MayFeed() (*Feed, error) {
+	feed, err := parseFeed(c.RawBody())
+	if err != nil {
+		return nil, err
+	}
+	if feed.Link != "" {
+		feed.Link = c.absURL(feed.Link)
+	}
+	for i := range feed.Entries {
+		entry := &feed.Entries[i]
+		if entry.Link != "" {
+			entry.Link = c.absURL(entry.Link)
+		}
+		if entry.GUID == "" {
+			entry.GUID = entry.Link
+		}
+	}
+	return feed, nil
+}
+
+// follow link of every entry of feed by callback, entry is got by Context.FeedEntry
+// entries without link are skipped
+func (c *Context) FollowFeedEntries(callback OnParseCallback) int {
+	cnt := 0
+	for _, entry := range c.Feed().Entries {
+		if entry.Link == "" {
+			continue
+		}
+		c.Follow(entry.Link, callback, H{
+			feedEntryKey: map[string]interface{}{
+				"Title":     entry.Title,
+				"Link":      entry.Link,
+				"GUID":      entry.GUID,
+				"Published": entry.Published.Format(time.RFC3339),
+				"Content":   entry.Content,
+			},
+		})
+		cnt++
+	}
+	return cnt
+}
+
+// entry of feed followed by FollowFeedEntries
+func (c *Context) FeedEntry() (FeedEntry, bool) {
+	val, ok := c.data[feedEntryKey]
+	if !ok {
+		return FeedEntry{}, false
+	}
+	fields, ok := val.(map[string]interface{})
+	if !ok {
+		return FeedEntry{}, false
+	}
+	str := func(key string) string {
+		s, _ := fields[key].(string)
+		return s
+	}
+	entry := FeedEntry{
+		Title:   str("Title"),
+		Link:    str("Link"),
+		GUID:    str("GUID"),
+		Content: str("Content"),
+	}
+	if published, err := time.Parse(time.RFC3339, str("Published")); err == nil && published.Year() > 1 {
+		entry.Published = published
+	}
+	return entry, true
+}
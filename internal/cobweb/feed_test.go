@@ -0,0 +1,115 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const rssTestFeed = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel>
+	<title>News</title>
+	<link>http://a.com/</link>
+	<item>
+		<title>First</title>
+		<link>/news/1</link>
+		<guid isPermaLink="false">news-1</guid>
+		<pubDate>Tue, 01 Mar 2022 08:00:00 +0800</pubDate>
+		<description>summary</description>
+		<content:encoded><![CDATA[<p>full</p>]]></content:encoded>
+	</item>
+	<item>
+		<title>Second</title>
+		<link>http://a.com/news/2</link>
+		<description>second summary</description>
+	</item>
+</channel>
+</rss>`
+
+const atomTestFeed = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Blog</title>
+	<link rel="self" href="http://b.com/feed.xml"/>
+	<link href="http://b.com/"/>
+	<entry>
+		<title>Post</title>
+		<link rel="alternate" href="http://b.com/post"/>
+		<id>urn:uuid:1</id>
+		<updated>2022-03-01T00:00:00Z</updated>
+		<summary>post summary</summary>
+	</entry>
+	<entry>
+		<title>Markup</title>
+		<link href="http://b.com/markup"/>
+		<updated>2022-03-01T00:00:00Z</updated>
+		<content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>a <b>b</b></p></div></content>
+	</entry>
+	<entry>
+		<title>Escaped</title>
+		<link href="http://b.com/escaped"/>
+		<content type="html">&lt;p&gt;c&lt;/p&gt;</content>
+	</entry>
+</feed>`
+
+func TestFeed(t *testing.T) {
+	published := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/feed", rssTestFeed)
+	feed := ctx.Feed()
+	assert.Equal(t, "News", feed.Title)
+	assert.Len(t, feed.Entries, 2)
+	assert.Equal(t, "http://a.com/news/1", feed.Entries[0].Link)
+	assert.Equal(t, "news-1", feed.Entries[0].GUID)
+	assert.Equal(t, "<p>full</p>", feed.Entries[0].Content)
+	assert.True(t, published.Equal(feed.Entries[0].Published))
+	assert.Equal(t, "http://a.com/news/2", feed.Entries[1].GUID)
+	assert.Equal(t, "second summary", feed.Entries[1].Content)
+
+	feed = NewTestSuits(t).ContextWithString("http://a.com/feed", atomTestFeed).Feed()
+	assert.Equal(t, "http://b.com/", feed.Link)
+	assert.Equal(t, FeedEntry{
+		Title:     "Post",
+		Link:      "http://b.com/post",
+		GUID:      "urn:uuid:1",
+		Published: published,
+		Content:   "post summary",
+	}, feed.Entries[0])
+	assert.Equal(t, `<div xmlns="http://www.w3.org/1999/xhtml"><p>a <b>b</b></p></div>`, feed.Entries[1].Content)
+	assert.Equal(t, "<p>c</p>", feed.Entries[2].Content)
+
+	info := func() (info *ParseErrorInfo) {
+		defer func() {
+			info, _ = recover().(*ParseErrorInfo)
+		}()
+		NewTestSuits(t).ContextWithString("http://a.com/feed", "<rss><channel><item>").Feed()
+		return nil
+	}()
+	assert.NotNil(t, info)
+	assert.Equal(t, ParseFeedError, info.ErrKind)
+	_, err := NewTestSuits(t).ContextWithString("http://a.com/feed", "<html></html>").MayFeed()
+	assert.Equal(t, errUnknownFeed, err)
+}
+
+func TestFollowFeedEntries(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/feed", rssTestFeed)
+	assert.Equal(t, 2, ctx.FollowFeedEntries(ctx.cmd.task.rule.InitParse))
+	assert.Len(t, ctx.commands(), 2)
+
+	// context data is saved in frontier as json
+	data, err := json.Marshal(ctx.commands()[0].contextData)
+	assert.Nil(t, err)
+	contextData := H{}
+	assert.Nil(t, json.Unmarshal(data, &contextData))
+	ctx.commands()[0].contextData = contextData
+
+	entry, ok := newContext(ctx.commands()[0]).FeedEntry()
+	assert.True(t, ok)
+	assert.Equal(t, "news-1", entry.GUID)
+	assert.True(t, time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC).Equal(entry.Published))
+	entry, ok = newContext(ctx.commands()[1]).FeedEntry()
+	assert.True(t, ok)
+	assert.True(t, entry.Published.IsZero())
+}
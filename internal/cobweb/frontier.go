@@ -0,0 +1,272 @@
+package cobweb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// CommandSpec is the serializable form of a command
+// it is what a Frontier stores, so several executors could share commands
+type CommandSpec struct {
+	ID       string
+	TaskID   string
+	TaskName string
+
+	Method string
+	URL    string
+	Header map[string]string
+	Body   []byte
+
+	// name of parse callback, see Task.callbackByName
+	Callback    string
+	Timeout     time.Duration
+	ContextData H
+
+	DownloadFailedCount int
+	ParseFailedCount    int
+	StatusRetryCount    int
+
+	// DontFilter commands skip dedup
+	DontFilter bool
+	NoCookies  bool
+
+	// stream download options, see FollowBuilder.MaxSize
+	StreamFile   string
+	MaxSize      int64
+	ChecksumAlgo string
+	Checksum     string
+	// Seen commands have been added to dedup set
+	Seen bool
+
+	// local command which creates this spec, only kept by memory frontier
+	cmd *command
+	// encoded data popped from remote frontier, used by Ack
+	raw []byte
+}
+
+// Frontier holds commands waiting for download,
+// dedup sets and stats of tasks
+type Frontier interface {
+	// add spec to frontier
+	Push(spec *CommandSpec) error
+	// wait at most timeout for a spec, return nil spec if there is none
+	Pop(timeout time.Duration) (*CommandSpec, error)
+	// popped spec is finished, completed, failed or pushed back for retry
+	Ack(spec *CommandSpec) error
+
+	// add fingerprint to task's dedup set, return false if it is already in
+	AddSeen(taskID, fingerprint string) (bool, error)
+
+	// add delta to task's stat and return new value
+	IncrStat(taskID, key string, delta int64) (int64, error)
+	Stats(taskID string) (map[string]int64, error)
+
+	Close() error
+}
+
+// fingerprint of request used by dedup set
+func (s *CommandSpec) fingerprint() string {
+	h := sha1.New()
+	h.Write([]byte(s.Method))
+	h.Write([]byte{' '})
+	h.Write([]byte(s.URL))
+	h.Write([]byte{' '})
+	h.Write(s.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newCommandSpec(cmd *command) *CommandSpec {
+	req := cmd.initialRequest()
+	spec := &CommandSpec{
+		ID:                  cmd.id.String(),
+		TaskID:              cmd.task.ID(),
+		TaskName:            cmd.task.Name(),
+		Method:              string(req.Header.Method()),
+		URL:                 req.URI().String(),
+		Header:              make(map[string]string),
+		Body:                append([]byte(nil), req.Body()...),
+		Callback:            cmd.task.registerCallback(cmd.onParseCallback),
+		Timeout:             cmd.downloadTimeout,
+		ContextData:         cmd.contextData,
+		DownloadFailedCount: cmd.downloadFailedCount,
+		ParseFailedCount:    cmd.parseFailedCount,
+		StatusRetryCount:    cmd.statusRetryCount,
+		DontFilter:          cmd.dontFilter,
+		NoCookies:           cmd.noCookies,
+		Seen:                cmd.seen,
+		cmd:                 cmd,
+	}
+	req.Header.VisitAll(func(key, value []byte) {
+		spec.Header[string(key)] = string(value)
+	})
+	if cmd.stream != nil {
+		spec.StreamFile = cmd.stream.fileName
+		spec.MaxSize = cmd.stream.maxSize
+		spec.ChecksumAlgo = cmd.stream.checksumAlgo
+		spec.Checksum = cmd.stream.checksum
+	}
+	return spec
+}
+
+// create command of task from spec
+// return nil if task doesn't know spec's callback
+func newCommandFromSpec(task *Task, spec *CommandSpec) *command {
+	if spec.cmd != nil {
+		spec.cmd.frontierSpec = spec
+		return spec.cmd
+	}
+
+	callback := task.callbackByName(spec.Callback)
+	if callback == nil {
+		return nil
+	}
+
+	id, err := xid.FromString(spec.ID)
+	if err != nil {
+		id = xid.New()
+	}
+
+	b := newCommandBuilder(task)
+	b.Link(spec.URL)
+	b.Callback(callback)
+	b.DownloadTimeout(spec.Timeout)
+	b.ContextData(spec.ContextData)
+	b.streamTo(spec.StreamFile)
+	b.MaxSize(spec.MaxSize)
+	b.Checksum(spec.ChecksumAlgo, spec.Checksum)
+	cmd := b.build()
+	cmd.id = id
+	cmd.downloadFailedCount = spec.DownloadFailedCount
+	cmd.parseFailedCount = spec.ParseFailedCount
+	cmd.statusRetryCount = spec.StatusRetryCount
+	cmd.dontFilter = spec.DontFilter
+	cmd.noCookies = spec.NoCookies
+	cmd.seen = spec.Seen
+	cmd.frontierSpec = spec
+
+	req := cmd.request()
+	req.Header.SetMethod(spec.Method)
+	for key, val := range spec.Header {
+		req.Header.Set(key, val)
+	}
+	req.SetBody(spec.Body)
+	return cmd
+}
+
+// memoryFrontier is the in-process Frontier
+// it keeps local command in spec, so nothing is serialized
+type memoryFrontier struct {
+	queueLocker sync.Mutex
+	queue       []*CommandSpec
+	notifyCh    chan struct{}
+
+	seenLocker sync.Mutex
+	seenSets   map[string]map[string]struct{}
+
+	statsLocker sync.Mutex
+	stats       map[string]map[string]int64
+}
+
+func NewMemoryFrontier() Frontier {
+	return &memoryFrontier{
+		notifyCh: make(chan struct{}, 1),
+		seenSets: make(map[string]map[string]struct{}),
+		stats:    make(map[string]map[string]int64),
+	}
+}
+
+func (f *memoryFrontier) Push(spec *CommandSpec) error {
+	f.queueLocker.Lock()
+	f.queue = append(f.queue, spec)
+	f.queueLocker.Unlock()
+
+	select {
+	case f.notifyCh <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (f *memoryFrontier) Pop(timeout time.Duration) (*CommandSpec, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		f.queueLocker.Lock()
+		if len(f.queue) != 0 {
+			spec := f.queue[0]
+			f.queue[0] = nil
+			f.queue = f.queue[1:]
+			remain := len(f.queue)
+			f.queueLocker.Unlock()
+
+			if remain != 0 {
+				// wake up other waiting routine
+				select {
+				case f.notifyCh <- struct{}{}:
+				default:
+				}
+			}
+			return spec, nil
+		}
+		f.queueLocker.Unlock()
+
+		select {
+		case <-f.notifyCh:
+		case <-timer.C:
+			return nil, nil
+		}
+	}
+}
+
+func (f *memoryFrontier) Ack(_ *CommandSpec) error {
+	return nil
+}
+
+func (f *memoryFrontier) AddSeen(taskID, fingerprint string) (bool, error) {
+	f.seenLocker.Lock()
+	defer f.seenLocker.Unlock()
+
+	seenSet, ok := f.seenSets[taskID]
+	if !ok {
+		seenSet = make(map[string]struct{})
+		f.seenSets[taskID] = seenSet
+	}
+	if _, ok := seenSet[fingerprint]; ok {
+		return false, nil
+	}
+	seenSet[fingerprint] = struct{}{}
+	return true, nil
+}
+
+func (f *memoryFrontier) IncrStat(taskID, key string, delta int64) (int64, error) {
+	f.statsLocker.Lock()
+	defer f.statsLocker.Unlock()
+
+	taskStats, ok := f.stats[taskID]
+	if !ok {
+		taskStats = make(map[string]int64)
+		f.stats[taskID] = taskStats
+	}
+	taskStats[key] += delta
+	return taskStats[key], nil
+}
+
+func (f *memoryFrontier) Stats(taskID string) (map[string]int64, error) {
+	f.statsLocker.Lock()
+	defer f.statsLocker.Unlock()
+
+	stats := make(map[string]int64)
+	for key, val := range f.stats[taskID] {
+		stats[key] = val
+	}
+	return stats, nil
+}
+
+func (f *memoryFrontier) Close() error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package cobweb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type frontierTestRule struct {
+}
+
+func (r *frontierTestRule) InitLinks() []string {
+	return []string{"http://example.com/"}
+}
+
+func (r *frontierTestRule) InitParse(ctx *Context) {
+}
+
+func (r *frontierTestRule) parseDetail(ctx *Context) {
+}
+
+func (r *frontierTestRule) Callbacks() []OnParseCallback {
+	return []OnParseCallback{r.parseDetail}
+}
+
+func testFrontier(t *testing.T, frontier Frontier) {
+	rule := &frontierTestRule{}
+	task := newTaskFromRule(rule, frontier)
+
+	b := newCommandBuilder(task)
+	b.Link("http://example.com/detail?id=1")
+	b.Cookie("session", "abc")
+	b.Callback(rule.parseDetail)
+	b.ContextData(H{"Page": 2, "Nested": H{"Title": "cobweb"}})
+	cmd := b.build()
+	spec := newCommandSpec(cmd)
+
+	added, err := frontier.AddSeen(task.ID(), spec.fingerprint())
+	assert.NoError(t, err)
+	assert.True(t, added)
+	added, err = frontier.AddSeen(task.ID(), newCommandSpec(b.build()).fingerprint())
+	assert.NoError(t, err)
+	assert.False(t, added)
+
+	assert.NoError(t, frontier.Push(spec))
+	popped, err := frontier.Pop(time.Second)
+	assert.NoError(t, err)
+	if !assert.NotNil(t, popped) {
+		return
+	}
+	assert.NoError(t, frontier.Ack(popped))
+
+	// another executor only knows callbacks listed by rule
+	otherTask := newTaskFromRule(&frontierTestRule{}, frontier)
+	popped.cmd = nil
+	newCmd := newCommandFromSpec(otherTask, popped)
+	if !assert.NotNil(t, newCmd) {
+		return
+	}
+	assert.Equal(t, "http://example.com/detail?id=1", newCmd.request().URI().String())
+	assert.Equal(t, "abc", string(newCmd.request().Header.Cookie("session")))
+	assert.Equal(t, callbackName(rule.parseDetail), callbackName(newCmd.onParseCallback))
+	assert.Equal(t, 2, newCmd.contextData["Page"])
+	assert.Equal(t, H{"Title": "cobweb"}, newCmd.contextData["Nested"])
+
+	empty, err := frontier.Pop(time.Millisecond)
+	assert.NoError(t, err)
+	assert.Nil(t, empty)
+
+	val, err := frontier.IncrStat(task.ID(), TaskStatRunningCMD, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), val)
+	val, err = frontier.IncrStat(task.ID(), TaskStatRunningCMD, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), val)
+	stats, err := frontier.Stats(task.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int64{TaskStatRunningCMD: 2}, stats)
+}
+
+func TestMemoryFrontier(t *testing.T) {
+	testFrontier(t, NewMemoryFrontier())
+}
+
+func TestRedisFrontier(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	frontier := NewRedisFrontier(server.Addr(), "cobweb-test")
+	defer frontier.Close()
+	testFrontier(t, frontier)
+
+	// acked spec is removed from processing list
+	assert.False(t, server.Exists("cobweb-test:processing"))
+}
+
+func TestJoinTask(t *testing.T) {
+	e := NewNoProxyDefaultExecutor()
+	defer e.Stop()
+
+	task := newTaskFromRule(&frontierTestRule{}, NewMemoryFrontier())
+	joined, err := e.JoinTask(&frontierTestRule{}, task.ID())
+	assert.NoError(t, err)
+	assert.Equal(t, task.ID(), joined.ID())
+	assert.Equal(t, task.folderPath(), joined.folderPath())
+
+	invalid := &CrawlRule{LinkRules: []LinkRule{{Allow: []string{`(`}}}}
+	_, err = e.JoinTask(invalid, task.ID())
+	assert.Error(t, err)
+	assert.Error(t, e.RegisterRule(invalid))
+	assert.NoError(t, e.RegisterRule(&frontierTestRule{}))
+	assert.Contains(t, e.rules, "frontierTestRule")
+}
@@ -0,0 +1,334 @@
+package cobweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+type CachePolicy int
+
+const (
+	// responses are not cached
+	CachePolicyNever CachePolicy = iota
+	// every cacheable response is cached and served without sending request again
+	CachePolicyAlways
+	// fresh responses are served from cache by Cache-Control and Expires,
+	// stale ones are revalidated by If-None-Match and If-Modified-Since
+	CachePolicyRespectCacheControl
+)
+
+// HTTPCacheConfig of task, responses are saved to Dir which is kept between runs
+// Dir is instance/httpcache/[task name] if it is empty
+// only responses of GET requests without cookies and auth are cached
+type HTTPCacheConfig struct {
+	Policy CachePolicy
+	Dir    string
+}
+
+type HTTPCacheRule interface {
+	HTTPCache() HTTPCacheConfig
+}
+
+// status codes cacheable by default
+var cacheableStatusCodes = map[int]bool{
+	fasthttp.StatusOK:                   true,
+	fasthttp.StatusNonAuthoritativeInfo: true,
+	fasthttp.StatusMovedPermanently:     true,
+	fasthttp.StatusNotFound:             true,
+	fasthttp.StatusGone:                 true,
+}
+
+// headers of cached response which aren't restored
+var uncachedHeaders = map[string]bool{
+	fasthttp.HeaderSetCookie:        true,
+	fasthttp.HeaderContentLength:    true,
+	fasthttp.HeaderTransferEncoding: true,
+	fasthttp.HeaderContentEncoding:  true,
+	fasthttp.HeaderConnection:       true,
+}
+
+type httpCacheEntry struct {
+	URL           string
+	StatusCode    int
+	Header        [][2]string
+	Body          []byte
+	RedirectChain []string `json:",omitempty"`
+	ETag          string   `json:",omitempty"`
+	LastModified  string   `json:",omitempty"`
+	StoredAt      time.Time
+	// zero if response has to be revalidated
+	FreshUntil time.Time
+}
+
+type httpCache struct {
+	policy CachePolicy
+	dir    string
+}
+
+func newHTTPCache(policy CachePolicy, dir string) *httpCache {
+	return &httpCache{policy: policy, dir: dir}
+}
+
+// key of request, method and body are part of it
+func httpCacheKey(req *fasthttp.Request) string {
+	h := sha256.New()
+	h.Write(req.Header.Method())
+	h.Write([]byte(" "))
+	h.Write(req.URI().FullURI())
+	h.Write([]byte("\n"))
+	h.Write(req.Body())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *httpCache) entryPath(key string) string {
+	return path.Join(c.dir, key[:2], key+".json")
+}
+
+// nil if request isn't cached
+func (c *httpCache) get(key string) *httpCacheEntry {
+	data, err := ioutil.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil
+	}
+	entry := &httpCacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"Key":   key,
+		}).Warn("broken http cache entry")
+		return nil
+	}
+	return entry
+}
+
+func (c *httpCache) put(key string, entry *httpCacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	entryPath := c.entryPath(key)
+	if err := os.MkdirAll(path.Dir(entryPath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := entryPath + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, entryPath)
+}
+
+// entry can be served without request
+func (c *httpCache) isFresh(entry *httpCacheEntry, now time.Time) bool {
+	switch c.policy {
+	case CachePolicyAlways:
+		return true
+	case CachePolicyRespectCacheControl:
+		return now.Before(entry.FreshUntil)
+	default:
+		return false
+	}
+}
+
+// entry of response, nil if it shouldn't be cached
+func (c *httpCache) newEntry(req *fasthttp.Request, resp *fasthttp.Response, now time.Time) *httpCacheEntry {
+	if !req.Header.IsGet() || !cacheableStatusCodes[resp.StatusCode()] {
+		return nil
+	}
+	directives := parseCacheControl(string(resp.Header.Peek(fasthttp.HeaderCacheControl)))
+	if c.policy == CachePolicyRespectCacheControl {
+		if _, ok := directives["no-store"]; ok {
+			return nil
+		}
+	}
+
+	entry := &httpCacheEntry{
+		URL:          req.URI().String(),
+		StatusCode:   resp.StatusCode(),
+		Body:         append([]byte(nil), resp.Body()...),
+		ETag:         string(resp.Header.Peek(fasthttp.HeaderETag)),
+		LastModified: string(resp.Header.Peek(fasthttp.HeaderLastModified)),
+		StoredAt:     now,
+		FreshUntil:   freshUntil(resp, directives, now),
+	}
+	resp.Header.VisitAll(func(key, value []byte) {
+		if !uncachedHeaders[string(key)] {
+			entry.Header = append(entry.Header, [2]string{string(key), string(value)})
+		}
+	})
+	return entry
+}
+
+// directive -> value, value is empty if directive doesn't have one
+func parseCacheControl(val string) map[string]string {
+	directives := make(map[string]string)
+	for _, directive := range strings.Split(val, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "" {
+			continue
+		}
+		name, value := directive, ""
+		if index := strings.Index(directive, "="); index != -1 {
+			name, value = directive[:index], strings.Trim(directive[index+1:], "\"")
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
+
+// expiration time of response, zero if it has to be revalidated
+func freshUntil(resp *fasthttp.Response, directives map[string]string, now time.Time) time.Time {
+	if _, ok := directives["no-cache"]; ok {
+		return time.Time{}
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if val, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(val)
+			if err != nil || seconds <= 0 {
+				return time.Time{}
+			}
+			return now.Add(time.Duration(seconds) * time.Second)
+		}
+	}
+
+	expires, err := http.ParseTime(string(resp.Header.Peek(fasthttp.HeaderExpires)))
+	if err != nil {
+		return time.Time{}
+	}
+	date, err := http.ParseTime(string(resp.Header.Peek(fasthttp.HeaderDate)))
+	if err != nil {
+		date = now
+	}
+	return now.Add(expires.Sub(date))
+}
+
+// write cached response to cmd like it is downloaded
+func (e *httpCacheEntry) writeTo(cmd *command) {
+	req, resp := cmd.request(), cmd.response()
+	// redirects of revalidation are recorded by doRedirects already
+	if len(e.RedirectChain) != 0 && len(cmd.redirectChain) == 0 {
+		if cmd.originalRequest == nil {
+			cmd.originalRequest = fasthttp.AcquireRequest()
+		}
+		req.CopyTo(cmd.originalRequest)
+		cmd.redirectChain = append([]string(nil), e.RedirectChain...)
+		req.SetRequestURI(e.RedirectChain[len(e.RedirectChain)-1])
+	}
+
+	resp.Reset()
+	resp.SetStatusCode(e.StatusCode)
+	for _, header := range e.Header {
+		resp.Header.Add(header[0], header[1])
+	}
+	resp.SetBody(e.Body)
+}
+
+// request of cmd carries session of auth or cookies, response of it is neither cached nor served from cache,
+// because cache key doesn't tell sessions apart
+func hasSession(cmd *command) bool {
+	if cmd.task.auth != nil {
+		return true
+	}
+	for _, req := range []*fasthttp.Request{cmd.initialRequest(), cmd.request()} {
+		if len(req.Header.Peek(fasthttp.HeaderCookie)) != 0 || len(req.Header.Peek(fasthttp.HeaderAuthorization)) != 0 {
+			return true
+		}
+	}
+	if cmd.noCookies || cmd.task.cookieJar == nil {
+		return false
+	}
+	return len(cmd.task.cookieJar.cookies(cmd.cookieJarKey, cmd.request().URI())) != 0
+}
+
+// response of cmd is written from a fresh entry of http cache of task,
+// return false if cmd should be downloaded
+func serveFreshCache(cmd *command) bool {
+	cache := cmd.task.httpCache
+	cmd.cacheKey, cmd.cacheHit, cmd.cacheRevalidated = "", false, false
+	if cache == nil || cmd.stream != nil || !cmd.request().Header.IsGet() || hasSession(cmd) {
+		return false
+	}
+	cmd.cacheKey = httpCacheKey(cmd.request())
+	entry := cache.get(cmd.cacheKey)
+	if entry == nil || !cache.isFresh(entry, time.Now()) {
+		return false
+	}
+	entry.writeTo(cmd)
+	cmd.cacheHit = true
+	return true
+}
+
+// download request of cmd by doRedirects, response is served from http cache of task if it can be
+func doCachedRedirects(client *fasthttp.Client, cmd *command) error {
+	if serveFreshCache(cmd) {
+		return nil
+	}
+	if cmd.cacheKey == "" {
+		return doRedirects(client, cmd)
+	}
+
+	// stale entry is revalidated
+	entry := cmd.task.httpCache.get(cmd.cacheKey)
+	req := cmd.request()
+	if entry != nil {
+		if entry.ETag != "" {
+			req.Header.Set(fasthttp.HeaderIfNoneMatch, entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set(fasthttp.HeaderIfModifiedSince, entry.LastModified)
+		}
+	}
+	err := doRedirects(client, cmd)
+	req.Header.Del(fasthttp.HeaderIfNoneMatch)
+	req.Header.Del(fasthttp.HeaderIfModifiedSince)
+	if cmd.originalRequest != nil {
+		cmd.originalRequest.Header.Del(fasthttp.HeaderIfNoneMatch)
+		cmd.originalRequest.Header.Del(fasthttp.HeaderIfModifiedSince)
+	}
+	if err != nil || entry == nil || cmd.response().StatusCode() != fasthttp.StatusNotModified {
+		return err
+	}
+
+	// headers of 304 response update cached ones
+	notModified := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseResponse(notModified)
+	cmd.response().CopyTo(notModified)
+	entry.writeTo(cmd)
+	resp := cmd.response()
+	notModified.Header.VisitAll(func(key, value []byte) {
+		if string(key) == fasthttp.HeaderSetCookie {
+			resp.Header.AddBytesKV(key, value)
+		} else if !uncachedHeaders[string(key)] {
+			resp.Header.SetBytesKV(key, value)
+		}
+	})
+	cmd.cacheHit = true
+	cmd.cacheRevalidated = true
+	return nil
+}
+
+// save response of cmd to http cache, called after response is decompressed
+func (c *httpCache) store(cmd *command) {
+	if cmd.cacheKey == "" || (cmd.cacheHit && !cmd.cacheRevalidated) || hasSession(cmd) {
+		return
+	}
+	now := time.Now()
+	entry := c.newEntry(cmd.request(), cmd.response(), now)
+	if entry == nil {
+		return
+	}
+	entry.RedirectChain = cmd.redirectChain
+	if err := c.put(cmd.cacheKey, entry); err != nil {
+		logrus.WithFields(cmd.logrusFields()).WithField("Error", err).Error("save http cache failed")
+	}
+}
@@ -0,0 +1,140 @@
+package cobweb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type httpCacheTestRule struct {
+	frontierTestRule
+	conf HTTPCacheConfig
+}
+
+func (r *httpCacheTestRule) HTTPCache() HTTPCacheConfig {
+	return r.conf
+}
+
+func TestHTTPCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-httpcache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	requests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "etag body")
+	})
+	mux.HandleFunc("/fresh", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "fresh body")
+	})
+	mux.HandleFunc("/nostore", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, "nostore body")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	download := func(task *Task, link string) *command {
+		b := newCommandBuilder(task)
+		b.Link(server.URL + link)
+		cmd := b.build()
+		cmd.downloadStart(nil)
+		cmd.downloadFinish(doCachedRedirects(&fasthttp.Client{}, cmd))
+		assert.Nil(t, cmd.downloadError)
+		return cmd
+	}
+
+	rule := &httpCacheTestRule{conf: HTTPCacheConfig{Policy: CachePolicyRespectCacheControl, Dir: dir}}
+	task := newInMemoryJarTask(rule)
+
+	// stale response is revalidated
+	cmd := download(task, "/etag")
+	assert.False(t, cmd.cacheHit)
+	cmd = download(task, "/etag")
+	assert.True(t, cmd.cacheHit)
+	assert.True(t, cmd.cacheRevalidated)
+	assert.Equal(t, 200, cmd.response().StatusCode())
+	assert.Equal(t, "etag body", string(cmd.response().Body()))
+	assert.Equal(t, 2, requests)
+
+	// fresh response is served without request
+	download(task, "/fresh")
+	cmd = download(task, "/fresh")
+	assert.True(t, newContext(cmd).FromCache())
+	assert.Equal(t, "fresh body", string(cmd.response().Body()))
+	assert.Equal(t, 3, requests)
+	// fresh response isn't counted as downloaded
+	b := newCommandBuilder(task)
+	b.Link(server.URL + "/fresh")
+	cmd = b.build()
+	uncompressedBytes := task.uncompressedBytes
+	cmd.downloadStart(nil)
+	assert.True(t, serveFreshCache(cmd))
+	cmd.downloadFinish(nil)
+	assert.Equal(t, uncompressedBytes, task.uncompressedBytes)
+
+	download(task, "/nostore")
+	cmd = download(task, "/nostore")
+	assert.False(t, cmd.cacheHit)
+	assert.Equal(t, 5, requests)
+	assert.Equal(t, 3, task.cacheHitCount)
+
+	// cached responses are served by always policy
+	rule.conf.Policy = CachePolicyAlways
+	task = newInMemoryJarTask(rule)
+	cmd = download(task, "/etag")
+	assert.True(t, cmd.cacheHit)
+	assert.False(t, cmd.cacheRevalidated)
+	assert.Equal(t, 5, requests)
+
+	// response of request with session isn't served from cache and isn't cached
+	uri := &fasthttp.URI{}
+	uri.Parse(nil, []byte(server.URL+"/"))
+	resp := &fasthttp.Response{}
+	resp.Header.Add("Set-Cookie", "sid=1; Path=/")
+	task.cookieJar.update("", uri, resp)
+	b = newCommandBuilder(task)
+	b.Link(server.URL + "/etag")
+	cmd = b.build()
+	assert.False(t, serveFreshCache(cmd))
+	assert.Empty(t, cmd.cacheKey)
+	cmd = download(task, "/fresh")
+	assert.False(t, cmd.cacheHit)
+	assert.Equal(t, "sid=1", string(cmd.request().Header.Peek(fasthttp.HeaderCookie)))
+	assert.Equal(t, 6, requests)
+
+	rule.conf.Policy = CachePolicyNever
+	task = newInMemoryJarTask(rule)
+	assert.Nil(t, task.httpCache)
+}
+
+func TestFreshUntil(t *testing.T) {
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	resp := &fasthttp.Response{}
+	resp.Header.Set(fasthttp.HeaderDate, "Tue, 01 Mar 2022 00:00:00 GMT")
+	resp.Header.Set(fasthttp.HeaderExpires, "Tue, 01 Mar 2022 01:00:00 GMT")
+	assert.Equal(t, now.Add(time.Hour), freshUntil(resp, parseCacheControl(""), now))
+	assert.Equal(t, now.Add(time.Minute), freshUntil(resp, parseCacheControl(`public, max-age="60"`), now))
+	assert.True(t, freshUntil(resp, parseCacheControl("no-cache, max-age=60"), now).IsZero())
+
+	// obsolete date formats are accepted
+	resp.Header.Set(fasthttp.HeaderExpires, "Tuesday, 01-Mar-22 01:00:00 GMT")
+	assert.Equal(t, now.Add(time.Hour), freshUntil(resp, parseCacheControl(""), now))
+}
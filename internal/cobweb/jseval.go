@@ -0,0 +1,229 @@
+package cobweb
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/robertkrimen/otto"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultScriptTimeout = time.Second
+	// calls nested in scripts at most
+	DefaultScriptStackDepth = 1000
+)
+
+var errScriptTimeout = errors.New("script evaluation timeout")
+
+// ScriptOptions of Context.EvalScripts
+type ScriptOptions struct {
+	// inline scripts selected by it are run in order, every inline script if it is empty
+	Selector string
+	// variables or expressions returned after scripts, window.X is the same as X
+	Vars []string
+	// code run after scripts
+	Code string
+	// time budget of the whole evaluation, DefaultScriptTimeout if it is zero
+	Timeout time.Duration
+}
+
+type ScriptResult struct {
+	// exported values of Vars, undefined or failed ones don't exist
+	Vars map[string]interface{}
+	// written by document.write and document.writeln
+	Output string
+	// errors thrown by scripts, following scripts are still run
+	Errors []string
+}
+
+// minimal window and document, functions implemented in go are prefixed by __cobweb
+const scriptShim = `
+var window = this, self = this, top = this, parent = this;
+var console = {log: function() {}, warn: function() {}, error: function() {}, info: function() {}};
+var navigator = {userAgent: __cobwebUserAgent, language: "zh-CN", platform: "Win32"};
+var location = __cobwebLocation;
+var __cobwebTimers = [];
+function setTimeout(fn) { __cobwebTimers.push(fn); return __cobwebTimers.length; }
+function setInterval(fn) { __cobwebTimers.push(fn); return __cobwebTimers.length; }
+function clearTimeout() {}
+function clearInterval() {}
+function __cobwebElement(fields) {
+	if (!fields) { return null; }
+	fields.style = {};
+	fields.getAttribute = function(name) { return __cobwebAttr(fields.__selector, name); };
+	fields.setAttribute = function() {};
+	fields.appendChild = function(child) { return child; };
+	return fields;
+}
+var document = {
+	cookie: "",
+	title: __cobwebTitle,
+	location: location,
+	write: function() { __cobwebWrite(Array.prototype.join.call(arguments, "")); },
+	writeln: function() { __cobwebWrite(Array.prototype.join.call(arguments, "") + "\n"); },
+	getElementById: function(id) { return __cobwebElement(__cobwebQuery("#" + id)); },
+	querySelector: function(selector) { return __cobwebElement(__cobwebQuery(selector)); },
+	createElement: function(tag) { return __cobwebElement({tagName: tag.toUpperCase(), innerHTML: "", textContent: ""}); },
+	addEventListener: function() {}
+};
+window.addEventListener = function() {};
+`
+
+// run inline scripts of page in a pure go interpreter with a minimal DOM shim
+// scripts with src attribute are skipped, timers are run after scripts
+func (c *Context) EvalScripts(opts ScriptOptions) (*ScriptResult, error) {
+	doc, err := c.MayDoc()
+	if err != nil {
+		return nil, err
+	}
+	if opts.Selector == "" {
+		opts.Selector = "script"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultScriptTimeout
+	}
+
+	result := &ScriptResult{Vars: make(map[string]interface{})}
+	vm, err := c.newScriptVM(doc, result)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := make([]string, 0)
+	doc.Find(opts.Selector).Each(func(_ int, selection *goquery.Selection) {
+		if _, ok := selection.Attr("src"); ok {
+			return
+		}
+		scriptType := strings.ToLower(selection.AttrOr("type", ""))
+		if scriptType != "" && !strings.Contains(scriptType, "javascript") && scriptType != "module" {
+			// json, templates and so on
+			return
+		}
+		scripts = append(scripts, selection.Text())
+	})
+	if opts.Code != "" {
+		scripts = append(scripts, opts.Code)
+	}
+
+	if err := runWithTimeout(vm, opts.Timeout, func() {
+		for _, script := range scripts {
+			if _, err := vm.Run(script); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+			}
+		}
+		if _, err := vm.Run("for (var i = 0; i < __cobwebTimers.length; i++) { try { if (typeof __cobwebTimers[i] === 'function') __cobwebTimers[i](); } catch (e) {} }"); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		for _, name := range opts.Vars {
+			value, err := vm.Run(name)
+			if err != nil || value.IsUndefined() {
+				continue
+			}
+			if exported, err := value.Export(); err == nil {
+				result.Vars[name] = exported
+			}
+		}
+	}); err != nil {
+		logrus.WithFields(c.logrusFields()).WithField("Error", err).Warn("eval scripts failed")
+		return result, err
+	}
+	return result, nil
+}
+
+func (c *Context) newScriptVM(doc *goquery.Document, result *ScriptResult) (*otto.Otto, error) {
+	vm := otto.New()
+	vm.SetStackDepthLimit(DefaultScriptStackDepth)
+
+	uri := c.cmd.request().URI()
+	location := map[string]interface{}{
+		"href":     uri.String(),
+		"protocol": string(uri.Scheme()) + ":",
+		"host":     string(uri.Host()),
+		"hostname": strings.Split(string(uri.Host()), ":")[0],
+		"pathname": string(uri.Path()),
+		"search":   "",
+		"hash":     "",
+	}
+	if len(uri.QueryString()) != 0 {
+		location["search"] = "?" + string(uri.QueryString())
+	}
+
+	output := &strings.Builder{}
+	values := map[string]interface{}{
+		"__cobwebUserAgent": string(c.cmd.request().Header.UserAgent()),
+		"__cobwebLocation":  location,
+		"__cobwebTitle":     doc.Find("title").First().Text(),
+		"__cobwebWrite": func(s string) {
+			output.WriteString(s)
+			result.Output = output.String()
+		},
+		"__cobwebQuery": func(selector string) map[string]interface{} {
+			selection := doc.Find(selector).First()
+			if selection.Length() == 0 {
+				return nil
+			}
+			html, _ := selection.Html()
+			return map[string]interface{}{
+				"__selector":  selector,
+				"id":          selection.AttrOr("id", ""),
+				"tagName":     strings.ToUpper(goquery.NodeName(selection)),
+				"innerHTML":   html,
+				"textContent": selection.Text(),
+				"innerText":   selection.Text(),
+				"value":       selection.AttrOr("value", ""),
+			}
+		},
+		"__cobwebAttr": func(selector string, name string) interface{} {
+			val, ok := doc.Find(selector).First().Attr(name)
+			if !ok {
+				return nil
+			}
+			return val
+		},
+		"atob": func(s string) string {
+			data, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				panic(vm.MakeCustomError("InvalidCharacterError", err.Error()))
+			}
+			return string(data)
+		},
+		"btoa": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+	}
+	for name, value := range values {
+		if err := vm.Set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := vm.Run(scriptShim); err != nil {
+		return nil, err
+	}
+	return vm, nil
+}
+
+// run fn and interrupt vm if it takes longer than timeout
+func runWithTimeout(vm *otto.Otto, timeout time.Duration, fn func()) (err error) {
+	vm.Interrupt = make(chan func(), 1)
+	timer := time.AfterFunc(timeout, func() {
+		vm.Interrupt <- func() {
+			panic(errScriptTimeout)
+		}
+	})
+	defer timer.Stop()
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught == errScriptTimeout {
+				err = errScriptTimeout
+				return
+			}
+			panic(caught)
+		}
+	}()
+	fn()
+	return nil
+}
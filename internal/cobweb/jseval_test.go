@@ -0,0 +1,56 @@
+package cobweb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvalScripts(t *testing.T) {
+	page := func(body string) *Context {
+		return NewTestSuits(t).ContextWithString("http://a.com/list?page=2", body)
+	}
+
+	ctx := page(`<html><body>
+<span id="port" data-key="ab">8080</span>
+<script src="/app.js"></script>
+<script type="application/ld+json">{"a": 1}</script>
+<script>
+	var proxies = [{host: "1.1.1.1", port: 80}];
+	window.config = {page: location.search, port: document.getElementById("port").textContent};
+	document.write("<b>" + atob("MTIzNA==") + "</b>");
+	undefinedFunction();
+</script>
+<script class="late">setTimeout(function() { document.writeln("late"); }, 1000);</script>
+</body></html>`)
+	result, err := ctx.EvalScripts(ScriptOptions{
+		Vars: []string{"proxies", "window.config", "missing", "document.getElementById('port').getAttribute('data-key')"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "<b>1234</b>late\n", result.Output)
+	assert.Len(t, result.Errors, 1)
+	assert.Equal(t, map[string]interface{}{"page": "?page=2", "port": "8080"}, result.Vars["window.config"])
+	assert.Len(t, result.Vars["proxies"], 1)
+	assert.Equal(t, "ab", result.Vars["document.getElementById('port').getAttribute('data-key')"])
+	_, ok := result.Vars["missing"]
+	assert.False(t, ok)
+
+	// selected scripts only
+	result, err = ctx.EvalScripts(ScriptOptions{Selector: "script.late", Vars: []string{"proxies"}})
+	assert.Nil(t, err)
+	assert.Empty(t, result.Vars)
+
+	// endless loop is interrupted by time budget
+	ctx = page(`<script>var i = 0; while (true) { i++; }</script>`)
+	start := time.Now()
+	_, err = ctx.EvalScripts(ScriptOptions{Timeout: 50 * time.Millisecond})
+	assert.Equal(t, errScriptTimeout, err)
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	// endless recursion is stopped by stack depth limit
+	ctx = page(`<script>function f() { return f(); } f();</script>`)
+	result, err = ctx.EvalScripts(ScriptOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, result.Errors, 1)
+}
@@ -0,0 +1,291 @@
+package cobweb
+
+import (
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
+
+	// decoders of image formats
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	DefaultMediaProcessorWorkers     = 2
+	DefaultMediaProcessorJPEGQuality = 85
+)
+
+// Thumbnail fits image in Width x Height, aspect ratio is kept
+type Thumbnail struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// MediaProcessorConfig of images saved by Context.SaveMedia
+// results are saved to [media dir]/derived/[hash]/ and recorded in manifest
+type MediaProcessorConfig struct {
+	Thumbnails []Thumbnail
+	// re-encode image to jpeg or png, metadata is stripped.
+	// if empty, only original image is kept with its metadata.
+	// thumbnails are always re-encoded, they never have metadata
+	Format      string
+	JPEGQuality int
+	// smaller images are removed from media store
+	MinWidth  int
+	MinHeight int
+	// images processed at the same time
+	Workers int
+}
+
+type MediaProcessorRule interface {
+	MediaProcessor() MediaProcessorConfig
+}
+
+// result of processing one image
+type mediaProcessResult struct {
+	Width      int               `json:",omitempty"`
+	Height     int               `json:",omitempty"`
+	Format     string            `json:",omitempty"`
+	Reencoded  string            `json:",omitempty"`
+	Thumbnails map[string]string `json:",omitempty"`
+	// reason of rejection, image is removed
+	Rejected string `json:",omitempty"`
+	// image can't be processed
+	Error string `json:",omitempty"`
+}
+
+// mediaProcessor processes stored media on its own workers, not in parser
+type mediaProcessor struct {
+	conf  MediaProcessorConfig
+	store *mediaStore
+
+	jobs chan MediaRef
+	wg   sync.WaitGroup
+
+	locker sync.Mutex
+	// hashes processed or being processed
+	processed map[string]struct{}
+
+	// media saved after stop is not processed
+	stopLocker sync.RWMutex
+	stopped    bool
+}
+
+func newMediaProcessor(conf MediaProcessorConfig, store *mediaStore) *mediaProcessor {
+	if conf.Workers <= 0 {
+		conf.Workers = DefaultMediaProcessorWorkers
+	}
+	if conf.JPEGQuality <= 0 {
+		conf.JPEGQuality = DefaultMediaProcessorJPEGQuality
+	}
+
+	p := &mediaProcessor{
+		conf:      conf,
+		store:     store,
+		jobs:      make(chan MediaRef, conf.Workers*4),
+		processed: make(map[string]struct{}),
+	}
+	p.wg.Add(conf.Workers)
+	for i := 0; i < conf.Workers; i++ {
+		go p.workRoutine()
+	}
+	return p
+}
+
+// process media of ref, the same content is processed once
+// media is dropped if queue of workers is full, parser isn't blocked
+func (p *mediaProcessor) process(ref MediaRef) {
+	p.stopLocker.RLock()
+	defer p.stopLocker.RUnlock()
+	if p.stopped {
+		logrus.WithField("URL", ref.URL).Warn("media processor has stopped, media isn't processed")
+		return
+	}
+
+	p.locker.Lock()
+	if _, ok := p.processed[ref.Hash]; ok {
+		p.locker.Unlock()
+		return
+	}
+	p.processed[ref.Hash] = struct{}{}
+	p.locker.Unlock()
+
+	select {
+	case p.jobs <- ref:
+	default:
+		p.locker.Lock()
+		delete(p.processed, ref.Hash)
+		p.locker.Unlock()
+		logrus.WithFields(logrus.Fields{
+			"URL":  ref.URL,
+			"Hash": ref.Hash,
+		}).Warn("media processor is busy, media isn't processed")
+	}
+}
+
+// wait until all media is processed
+func (p *mediaProcessor) stop() {
+	p.stopLocker.Lock()
+	if !p.stopped {
+		p.stopped = true
+		close(p.jobs)
+	}
+	p.stopLocker.Unlock()
+	p.wg.Wait()
+}
+
+func (p *mediaProcessor) workRoutine() {
+	defer p.wg.Done()
+	for ref := range p.jobs {
+		result := p.processImage(ref)
+		if err := p.store.setProcessResult(ref.Hash, result); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"Error": err,
+				"Hash":  ref.Hash,
+			}).Error("save media process result failed")
+		}
+		logrus.WithFields(logrus.Fields{
+			"URL":      ref.URL,
+			"Hash":     ref.Hash,
+			"Rejected": result.Rejected,
+			"Error":    result.Error,
+		}).Info("media processed")
+	}
+}
+
+func (p *mediaProcessor) processImage(ref MediaRef) *mediaProcessResult {
+	result := &mediaProcessResult{}
+	objectPath := path.Join(p.store.dir, ref.Path)
+
+	img, format, err := decodeImage(objectPath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	bounds := img.Bounds()
+	result.Width, result.Height, result.Format = bounds.Dx(), bounds.Dy(), format
+
+	if bounds.Dx() < p.conf.MinWidth || bounds.Dy() < p.conf.MinHeight {
+		result.Rejected = fmt.Sprintf("%dx%d is smaller than %dx%d", bounds.Dx(), bounds.Dy(), p.conf.MinWidth, p.conf.MinHeight)
+		if err := p.store.remove(ref.Hash); err != nil {
+			result.Error = err.Error()
+		}
+		return result
+	}
+
+	outFormat := p.conf.Format
+	if outFormat == "" {
+		outFormat = format
+	}
+	derivedDir := path.Join("derived", ref.Hash)
+	if err := os.MkdirAll(path.Join(p.store.dir, derivedDir), os.ModePerm); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if p.conf.Format != "" {
+		reencoded := path.Join(derivedDir, "reencoded."+imageExt(outFormat))
+		if err := p.encodeImage(path.Join(p.store.dir, reencoded), img, outFormat); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Reencoded = reencoded
+	}
+
+	for _, thumbnail := range p.conf.Thumbnails {
+		thumbnailPath := path.Join(derivedDir, thumbnail.Name+"."+imageExt(outFormat))
+		if err := p.encodeImage(path.Join(p.store.dir, thumbnailPath), resizeToFit(img, thumbnail.Width, thumbnail.Height), outFormat); err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		if result.Thumbnails == nil {
+			result.Thumbnails = make(map[string]string)
+		}
+		result.Thumbnails[thumbnail.Name] = thumbnailPath
+	}
+	return result
+}
+
+func decodeImage(filePath string) (image.Image, string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+	return image.Decode(file)
+}
+
+// image is written to a temp file and renamed
+func (p *mediaProcessor) encodeImage(filePath string, img image.Image, format string) error {
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: p.conf.JPEGQuality})
+	case "gif":
+		err = gif.Encode(file, img, nil)
+	default:
+		// formats can't be encoded by standard library are saved as png
+		err = png.Encode(file, img)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+func imageExt(format string) string {
+	switch format {
+	case "jpeg":
+		return "jpg"
+	case "gif":
+		return "gif"
+	default:
+		return "png"
+	}
+}
+
+// scale img down to fit in width x height, img is returned if it fits already
+// zero width or height means no limit
+func resizeToFit(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	scale := 1.0
+	if width > 0 && bounds.Dx() > width {
+		scale = float64(width) / float64(bounds.Dx())
+	}
+	if height > 0 && float64(bounds.Dy())*scale > float64(height) {
+		scale = float64(height) / float64(bounds.Dy())
+	}
+	if scale >= 1 {
+		return img
+	}
+
+	newWidth := int(float64(bounds.Dx())*scale + 0.5)
+	newHeight := int(float64(bounds.Dy())*scale + 0.5)
+	if newWidth < 1 {
+		newWidth = 1
+	}
+	if newHeight < 1 {
+		newHeight = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, newWidth, newHeight))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
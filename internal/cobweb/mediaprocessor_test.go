@@ -0,0 +1,84 @@
+package cobweb
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaProcessor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-media")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := newMediaStore(dir, true)
+	storeImage := func(link string, name string, width int, height int) MediaRef {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for x := 0; x < width; x++ {
+			img.Set(x, 0, color.RGBA{R: uint8(x), A: 255})
+		}
+		tempPath := path.Join(dir, store.newTempName())
+		assert.Nil(t, os.MkdirAll(path.Dir(tempPath), os.ModePerm))
+		file, err := os.Create(tempPath)
+		assert.Nil(t, err)
+		assert.Nil(t, png.Encode(file, img))
+		file.Close()
+
+		ref, err := store.store(tempPath, link, name)
+		assert.Nil(t, err)
+		return ref
+	}
+
+	processor := newMediaProcessor(MediaProcessorConfig{
+		Thumbnails: []Thumbnail{{Name: "small", Width: 40, Height: 40}},
+		Format:     "jpeg",
+		MinWidth:   50,
+		MinHeight:  50,
+	}, store)
+	large := storeImage("http://a.com/large.png", "large.png", 200, 100)
+	small := storeImage("http://a.com/small.png", "small.png", 20, 20)
+	processor.process(large)
+	processor.process(large)
+	processor.process(small)
+	processor.stop()
+	// media saved after task finished is dropped
+	processor.process(storeImage("http://a.com/late.png", "late.png", 60, 60))
+	processor.stop()
+
+	result := store.processResult(large.Hash)
+	assert.NotNil(t, result)
+	assert.Equal(t, 200, result.Width)
+	assert.Equal(t, "png", result.Format)
+	assert.Empty(t, result.Rejected)
+	assert.Equal(t, "derived/"+large.Hash+"/reencoded.jpg", result.Reencoded)
+
+	thumbnail, format, err := decodeImage(path.Join(dir, result.Thumbnails["small"]))
+	assert.Nil(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Equal(t, 40, thumbnail.Bounds().Dx())
+	assert.Equal(t, 20, thumbnail.Bounds().Dy())
+
+	// small image is removed, and it isn't saved again
+	result = store.processResult(small.Hash)
+	assert.NotEmpty(t, result.Rejected)
+	_, err = os.Stat(path.Join(dir, small.Path))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Lstat(path.Join(dir, "files", "small.png"))
+	assert.True(t, os.IsNotExist(err))
+	again := storeImage("http://b.com/small.png", "small2.png", 20, 20)
+	assert.Empty(t, again.Path)
+
+	store = newMediaStore(dir, true)
+	assert.NotNil(t, store.byURL["http://a.com/large.png"].Processed)
+
+	// media is dropped when queue of workers is full
+	busy := &mediaProcessor{jobs: make(chan MediaRef), processed: make(map[string]struct{})}
+	busy.process(large)
+	assert.Empty(t, busy.processed)
+}
@@ -0,0 +1,360 @@
+package cobweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/sirupsen/logrus"
+)
+
+// MediaStoreConfig of task, media is saved to [task folder]/[Dir]
+//
+//	objects/[hash[:2]]/[hash][ext]   content addressed files
+//	files/[name]                     symlinks to objects if Symlinks is true
+//	manifest.json                    url and name -> hash
+//	tmp/                             files being downloaded
+type MediaStoreConfig struct {
+	Dir      string
+	Symlinks bool
+}
+
+type MediaStoreRule interface {
+	MediaStore() MediaStoreConfig
+}
+
+var DefaultMediaStoreConfig = MediaStoreConfig{
+	Dir: "media",
+}
+
+// MediaRef is an item field refers to media saved by Context.SaveMedia
+// Hash and Path are empty if media is not downloaded yet when item is added,
+// they are resolved by media store when ref is marshaled to json or by Resolved
+type MediaRef struct {
+	URL  string
+	Name string
+	Hash string
+	// relative to media store dir
+	Path string
+
+	// store downloading media of ref
+	store *mediaStore
+}
+
+// ref with Hash and Path of media saved by now
+func (r MediaRef) Resolved() MediaRef {
+	if r.store != nil && r.Hash == "" {
+		if record := r.store.lookup(r.URL); record != nil {
+			r.Hash = record.Hash
+			r.Path = record.Path
+		}
+	}
+	r.store = nil
+	return r
+}
+
+func (r MediaRef) MarshalJSON() ([]byte, error) {
+	type mediaRefJSON MediaRef
+	return json.Marshal(mediaRefJSON(r.Resolved()))
+}
+
+type mediaRecord struct {
+	URL       string
+	Name      string
+	Hash      string
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+	// set by media processor
+	Processed *mediaProcessResult `json:",omitempty"`
+}
+
+type mediaStore struct {
+	dir      string
+	symlinks bool
+
+	locker  sync.RWMutex
+	records []*mediaRecord
+	byURL   map[string]*mediaRecord
+	// url being downloaded -> names to save it under
+	inflight map[string][]string
+}
+
+func newMediaStore(dir string, symlinks bool) *mediaStore {
+	s := &mediaStore{
+		dir:      dir,
+		symlinks: symlinks,
+		byURL:    make(map[string]*mediaRecord),
+		inflight: make(map[string][]string),
+	}
+	if err := s.load(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"Dir":   dir,
+		}).Error("load media manifest failed")
+	}
+	return s
+}
+
+func (s *mediaStore) manifestPath() string {
+	return path.Join(s.dir, "manifest.json")
+}
+
+func (s *mediaStore) load() error {
+	data, err := ioutil.ReadFile(s.manifestPath())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	records := make([]*mediaRecord, 0)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return err
+	}
+	for _, record := range records {
+		s.addRecord(record)
+	}
+	return nil
+}
+
+// caller holds locker
+func (s *mediaStore) addRecord(record *mediaRecord) {
+	if old, ok := s.byURL[record.URL]; ok && old.Name == record.Name {
+		*old = *record
+		record = old
+	} else {
+		s.records = append(s.records, record)
+	}
+	s.byURL[record.URL] = record
+}
+
+// caller holds locker
+func (s *mediaStore) saveManifest() error {
+	data, err := json.MarshalIndent(s.records, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		return err
+	}
+	tmpPath := s.manifestPath() + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, os.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.manifestPath())
+}
+
+// media of link is saved under name, it's downloaded only by the first caller,
+// callers of link being downloaded wait for it and return false
+func (s *mediaStore) reserve(link string, name string) (MediaRef, bool) {
+	s.locker.Lock()
+	if _, ok := s.byURL[link]; ok {
+		s.locker.Unlock()
+		if ref, ok := s.alias(link, name); ok {
+			return ref, false
+		}
+		return MediaRef{URL: link, Name: name, store: s}, false
+	}
+	names, downloading := s.inflight[link]
+	s.inflight[link] = append(names, name)
+	s.locker.Unlock()
+	return MediaRef{URL: link, Name: name, store: s}, !downloading
+}
+
+// names waiting for link, link is not in flight anymore
+func (s *mediaStore) release(link string) []string {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	names := s.inflight[link]
+	delete(s.inflight, link)
+	return names
+}
+
+// saved record of link, nil if it isn't saved
+func (s *mediaStore) lookup(link string) *mediaRecord {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+	record, ok := s.byURL[link]
+	if !ok {
+		return nil
+	}
+	recordCopy := *record
+	return &recordCopy
+}
+
+// media downloaded from link is saved under name too
+// return false if link is not downloaded
+func (s *mediaStore) alias(link string, name string) (MediaRef, bool) {
+	s.locker.RLock()
+	record, ok := s.byURL[link]
+	if ok {
+		recordCopy := *record
+		record = &recordCopy
+	}
+	s.locker.RUnlock()
+	if !ok {
+		return MediaRef{}, false
+	}
+	if record.Name == name {
+		return MediaRef{URL: record.URL, Name: record.Name, Hash: record.Hash, Path: record.Path}, true
+	}
+
+	ref, err := s.record(link, name, record.Hash, record.Path, record.Size)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error": err,
+			"URL":   link,
+			"Name":  name,
+		}).Error("save media alias failed")
+	}
+	return ref, err == nil
+}
+
+// relative path of a new temp file
+func (s *mediaStore) newTempName() string {
+	return path.Join("tmp", xid.New().String())
+}
+
+// move downloaded temp file to objects, the same content is saved only once
+func (s *mediaStore) store(tempPath string, link string, name string) (MediaRef, error) {
+	file, err := os.Open(tempPath)
+	if err != nil {
+		return MediaRef{}, err
+	}
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	file.Close()
+	if err != nil {
+		return MediaRef{}, err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))
+
+	if result := s.processResult(hash); result != nil && result.Rejected != "" {
+		// the same content was rejected by media processor
+		os.Remove(tempPath)
+		return s.record(link, name, hash, "", size)
+	}
+
+	objectPath := path.Join("objects", hash[:2], hash+strings.ToLower(path.Ext(name)))
+	absObjectPath := path.Join(s.dir, objectPath)
+	if _, err := os.Stat(absObjectPath); err == nil {
+		os.Remove(tempPath)
+	} else {
+		if err := os.MkdirAll(path.Dir(absObjectPath), os.ModePerm); err != nil {
+			return MediaRef{}, err
+		}
+		if err := os.Rename(tempPath, absObjectPath); err != nil {
+			return MediaRef{}, err
+		}
+	}
+
+	return s.record(link, name, hash, objectPath, size)
+}
+
+// add link and name of existing object to manifest
+func (s *mediaStore) record(link string, name string, hash string, objectPath string, size int64) (MediaRef, error) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	record := &mediaRecord{
+		URL:       link,
+		Name:      name,
+		Hash:      hash,
+		Path:      objectPath,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	for _, r := range s.records {
+		if r.Hash == hash && r.Processed != nil {
+			record.Processed = r.Processed
+			break
+		}
+	}
+	s.addRecord(record)
+	if err := s.saveManifest(); err != nil {
+		return MediaRef{}, err
+	}
+	if s.symlinks && name != "" && objectPath != "" {
+		if err := s.symlink(name, objectPath); err != nil {
+			return MediaRef{}, err
+		}
+	}
+	return MediaRef{URL: link, Name: name, Hash: hash, Path: objectPath}, nil
+}
+
+// files/[name] -> objects/..., existing link of name is replaced
+func (s *mediaStore) symlink(name string, objectPath string) error {
+	linkPath := path.Join(s.dir, "files", name)
+	if err := os.MkdirAll(path.Dir(linkPath), os.ModePerm); err != nil {
+		return err
+	}
+	target, err := filepath.Rel(path.Dir(linkPath), path.Join(s.dir, objectPath))
+	if err != nil {
+		return err
+	}
+	os.Remove(linkPath)
+	return os.Symlink(target, linkPath)
+}
+
+// result of media processor of hash, nil if it isn't processed
+func (s *mediaStore) processResult(hash string) *mediaProcessResult {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+	for _, record := range s.records {
+		if record.Hash == hash && record.Processed != nil {
+			return record.Processed
+		}
+	}
+	return nil
+}
+
+// record result of every record of hash
+func (s *mediaStore) setProcessResult(hash string, result *mediaProcessResult) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	for _, record := range s.records {
+		if record.Hash == hash {
+			record.Processed = result
+			if result.Rejected != "" {
+				record.Path = ""
+			}
+		}
+	}
+	return s.saveManifest()
+}
+
+// remove object of hash and its symlinks
+func (s *mediaStore) remove(hash string) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	objectPath := ""
+	for _, record := range s.records {
+		if record.Hash != hash {
+			continue
+		}
+		if s.symlinks && record.Name != "" {
+			os.Remove(path.Join(s.dir, "files", record.Name))
+		}
+		if record.Path != "" {
+			objectPath = record.Path
+		}
+	}
+	if objectPath == "" {
+		return nil
+	}
+	if err := os.Remove(path.Join(s.dir, objectPath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
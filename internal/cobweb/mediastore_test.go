@@ -0,0 +1,73 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb-media")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	store := newMediaStore(dir, true)
+	writeTemp := func(content string) string {
+		tempPath := path.Join(dir, store.newTempName())
+		assert.Nil(t, os.MkdirAll(path.Dir(tempPath), os.ModePerm))
+		assert.Nil(t, ioutil.WriteFile(tempPath, []byte(content), os.ModePerm))
+		return tempPath
+	}
+
+	ref1, err := store.store(writeTemp("cover"), "http://a.com/1.jpg", "肖申克的救赎/cover.jpg")
+	assert.Nil(t, err)
+	ref2, err := store.store(writeTemp("cover"), "http://b.com/2.jpg", "cover.JPG")
+	assert.Nil(t, err)
+	assert.Equal(t, ref1.Hash, ref2.Hash)
+	assert.Equal(t, ref1.Path, ref2.Path)
+	assert.Equal(t, "objects/"+ref1.Hash[:2]+"/"+ref1.Hash+".jpg", ref1.Path)
+
+	objects, err := ioutil.ReadDir(path.Join(dir, "objects", ref1.Hash[:2]))
+	assert.Nil(t, err)
+	assert.Len(t, objects, 1)
+	content, err := ioutil.ReadFile(path.Join(dir, "files", "肖申克的救赎", "cover.jpg"))
+	assert.Nil(t, err)
+	assert.Equal(t, "cover", string(content))
+
+	// downloaded link is not downloaded again
+	ref3, ok := store.alias("http://a.com/1.jpg", "another.jpg")
+	assert.True(t, ok)
+	assert.Equal(t, ref1.Hash, ref3.Hash)
+	_, ok = store.alias("http://c.com/3.jpg", "3.jpg")
+	assert.False(t, ok)
+
+	store = newMediaStore(dir, true)
+	assert.Len(t, store.records, 3)
+	ref4, ok := store.alias("http://b.com/2.jpg", "cover.JPG")
+	assert.True(t, ok)
+	assert.Equal(t, ref2, ref4)
+
+
+	// link is downloaded once, ref is resolved when download completes
+	ref5, download := store.reserve("http://c.com/3.jpg", "3.jpg")
+	assert.True(t, download)
+	ref6, download := store.reserve("http://c.com/3.jpg", "three.jpg")
+	assert.False(t, download)
+	assert.Empty(t, ref6.Resolved().Hash)
+	ref7, err := store.store(writeTemp("three"), "http://c.com/3.jpg", "3.jpg")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3.jpg", "three.jpg"}, store.release("http://c.com/3.jpg"))
+	assert.Equal(t, ref7, ref5.Resolved())
+	assert.Equal(t, ref7.Path, ref6.Resolved().Path)
+	data, err := json.Marshal(ref6)
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf(`{"URL":"http://c.com/3.jpg","Name":"three.jpg","Hash":"%s","Path":"%s"}`, ref7.Hash, ref7.Path), string(data))
+	ref8, download := store.reserve("http://c.com/3.jpg", "3.jpg")
+	assert.False(t, download)
+	assert.Equal(t, ref7, ref8)
+}
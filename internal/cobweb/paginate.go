@@ -0,0 +1,112 @@
+package cobweb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// context data of pagination is kept per callback,
+// so pages followed from a paginated page start from page 1 again
+const (
+	pageNumKeyPrefix  = "Cobweb-PageNum-"
+	pageHashKeyPrefix = "Cobweb-PageHash-"
+)
+
+// {n}, {n*25}, {n+1} and {n*25+1} in url template
+var pageTemplateRegexp = regexp.MustCompile(`\{\s*n\s*(?:\*\s*(\d+)\s*)?(?:([+-])\s*(\d+)\s*)?\}`)
+
+// number of page parsed by context, starts from 1
+func (c *Context) PageNum() int {
+	switch val := c.data[pageNumKeyPrefix+callbackName(c.cmd.onParseCallback)].(type) {
+	case int:
+		return val
+	case float64:
+		// context data loaded from frontier
+		return int(val)
+	default:
+		return 1
+	}
+}
+
+// follow href of the first element found by nextSelector by callback
+// pagination stops if next link isn't found, page repeats the last one or maxPages is reached
+// maxPages is unlimited if it is zero, return false if pagination stops
+func (c *Context) Paginate(nextSelector string, callback OnParseCallback, maxPages int) bool {
+	if !c.nextPageAllowed(callback, maxPages) {
+		return false
+	}
+	doc, err := c.MayDoc()
+	if err != nil {
+		c.panicByHTMLParseError(err)
+	}
+	next, ok := doc.Find(nextSelector).First().Attr("href")
+	if !ok || strings.TrimSpace(next) == "" {
+		return false
+	}
+	c.followPage(next, callback)
+	return true
+}
+
+// follow url of next page built from template by callback, n in template starts from 0
+//
+//	ctx.PaginateURL("https://movie.douban.com/top250?start={n*25}", r.InitParse, 10)
+//
+// pagination stops if response isn't 200, page repeats the last one or maxPages is reached
+func (c *Context) PaginateURL(template string, callback OnParseCallback, maxPages int) bool {
+	if c.cmd.response().StatusCode() != 200 || !c.nextPageAllowed(callback, maxPages) {
+		return false
+	}
+	c.followPage(pageURL(template, c.PageNum()), callback)
+	return true
+}
+
+// url of page n, n starts from 0
+func pageURL(template string, n int) string {
+	return pageTemplateRegexp.ReplaceAllStringFunc(template, func(expr string) string {
+		groups := pageTemplateRegexp.FindStringSubmatch(expr)
+		val := n
+		if groups[1] != "" {
+			multiplier, _ := strconv.Atoi(groups[1])
+			val *= multiplier
+		}
+		if groups[3] != "" {
+			offset, _ := strconv.Atoi(groups[3])
+			if groups[2] == "-" {
+				offset = -offset
+			}
+			val += offset
+		}
+		return strconv.Itoa(val)
+	})
+}
+
+func (c *Context) pageHash() string {
+	h := sha256.Sum256(c.utf8Body())
+	return hex.EncodeToString(h[:])
+}
+
+func (c *Context) nextPageAllowed(callback OnParseCallback, maxPages int) bool {
+	if maxPages > 0 && c.PageNum() >= maxPages {
+		return false
+	}
+	// site returns the last page for pages out of range
+	name := callbackName(c.cmd.onParseCallback)
+	if last, ok := c.data[pageHashKeyPrefix+name].(string); ok && last == c.pageHash() {
+		logrus.WithFields(c.logrusFields()).Info("page repeats the last one, pagination stops")
+		return false
+	}
+	return true
+}
+
+func (c *Context) followPage(link string, callback OnParseCallback) {
+	name := callbackName(callback)
+	c.Follow(link, callback, H{
+		pageNumKeyPrefix + name:  c.PageNum() + 1,
+		pageHashKeyPrefix + name: c.pageHash(),
+	})
+}
@@ -0,0 +1,67 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginate(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/list", `<a class="next" href="/list?page=2">next</a>`)
+	callback := ctx.cmd.task.rule.InitParse
+	page := func(cmd *command, body string) *Context {
+		cmd.onParseCallback = callback
+		cmd.response().SetBodyString(body)
+		return newContext(cmd)
+	}
+
+	assert.Equal(t, 1, ctx.PageNum())
+	assert.True(t, ctx.Paginate("a.next", callback, 3))
+	assert.Equal(t, "http://a.com/list?page=2", ctx.commands()[0].request().URI().String())
+
+	// page number is saved in frontier as json
+	data, err := json.Marshal(ctx.commands()[0].contextData)
+	assert.Nil(t, err)
+	ctx.commands()[0].contextData = H{}
+	assert.Nil(t, json.Unmarshal(data, &ctx.commands()[0].contextData))
+
+	ctx = page(ctx.commands()[0], `<a class="next" href="/list?page=3">next</a>`)
+	assert.Equal(t, 2, ctx.PageNum())
+	assert.True(t, ctx.Paginate("a.next", callback, 3))
+	last := ctx.commands()[0]
+	ctx = page(last, `<a class="next" href="/list?page=4">next</a>`)
+	assert.Equal(t, 3, ctx.PageNum())
+	assert.False(t, ctx.Paginate("a.next", callback, 3))
+
+	// no next link
+	ctx = page(last, `<p>end</p>`)
+	assert.False(t, ctx.Paginate("a.next", callback, 0))
+
+	// page repeats the last one
+	ctx = page(last, `<a class="next" href="/list?page=5">next</a>`)
+	assert.True(t, ctx.Paginate("a.next", callback, 0))
+	ctx = page(ctx.commands()[0], `<a class="next" href="/list?page=5">next</a>`)
+	assert.False(t, ctx.Paginate("a.next", callback, 0))
+
+	// pages of other callbacks start from 1
+	detail := ctx.NewFollowBuilder()
+	detail.Link("http://a.com/detail")
+	detail.Callback(saveResourceCallback)
+	assert.Equal(t, 1, newContext(detail.build()).PageNum())
+}
+
+func TestPaginateURL(t *testing.T) {
+	assert.Equal(t, "http://a.com/?start=50&page=3&p=1", pageURL("http://a.com/?start={n*25}&page={ n + 1 }&p={n-1}", 2))
+
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/?start=0", "page 1")
+	task := ctx.cmd.task
+	assert.True(t, ctx.PaginateURL("/?start={n*25}", task.rule.InitParse, 2))
+	next := ctx.commands()[0]
+	assert.Equal(t, "http://a.com/?start=25", next.request().URI().String())
+
+	ctx = newContext(next)
+	assert.False(t, ctx.PaginateURL("/?start={n*25}", task.rule.InitParse, 2))
+	ctx.cmd.response().SetStatusCode(404)
+	assert.False(t, ctx.PaginateURL("/?start={n*25}", task.rule.InitParse, 0))
+}
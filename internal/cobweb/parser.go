@@ -69,6 +69,8 @@ func (p *parser) parseRoutine(routineID int) {
 				cmd.task.recordFailedCommand(cmd)
 				continue
 			} else if cmd.needRetry {
+				// command will be pushed to frontier again
+				cmd.ack()
 				newCMDs = append(newCMDs, cmd)
 				cmd.needRetry = false
 			}
@@ -60,6 +60,7 @@ func (this *Proxy) Json() string {
 
 type ProxyPool struct {
 	e         *Executor
+	storage   AbsProxyStorage
 	startOnce sync.Once
 
 	workCron *cron.Cron
@@ -77,11 +78,13 @@ type ProxyPool struct {
 
 func NewProxyPool(
 	executor *Executor,
+	storage AbsProxyStorage,
 	proxyReqTimeout time.Duration,
 	checkRoutineMaxCount int,
 ) *ProxyPool {
 	p := &ProxyPool{
 		e:                   executor,
+		storage:             storage,
 		workCron:            cron.New(),
 		proxyReqTimeout:     proxyReqTimeout,
 		checkRoutineLimitCh: make(chan struct{}, checkRoutineMaxCount),
@@ -112,7 +115,7 @@ func (p *ProxyPool) Stop() {
 func (p *ProxyPool) fetchProxy() {
 	tasks := make([]*Task, 0, len(proxyFetchRuleCreators))
 	for _, creator := range proxyFetchRuleCreators {
-		t := p.e.AcceptRule(creator())
+		t := p.e.AcceptRule(creator(p.storage))
 		tasks = append(tasks, t)
 	}
 
@@ -138,7 +141,7 @@ func (p *ProxyPool) checkProxyPool() {
 
 	startTime := time.Now()
 
-	proxies, err := ProxyStorageSingleton().GetAllProxy()
+	proxies, err := p.storage.GetAllProxy()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
@@ -204,7 +207,7 @@ func (p *ProxyPool) checkProxy(
 			if originVal, ok := val["origin"]; ok {
 				origin, ok := originVal.(string)
 				if ok && origin == proxy.Host {
-					err := ProxyStorageSingleton().ActivateProxy(proxy)
+					err := p.storage.ActivateProxy(proxy)
 					if err != nil {
 						logrus.WithFields(logrus.Fields{
 							"Error": err,
@@ -229,7 +232,7 @@ func (p *ProxyPool) checkProxy(
 	//	"Error":    err,
 	//}).Debug("DeActivate Proxy")
 
-	err = ProxyStorageSingleton().DeactivateProxy(proxy)
+	err = p.storage.DeactivateProxy(proxy)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"Error": err,
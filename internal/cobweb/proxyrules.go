@@ -5,7 +5,7 @@ import (
 	"strings"
 )
 
-var proxyFetchRuleCreators = []func() BaseRule{
+var proxyFetchRuleCreators = []func(storage AbsProxyStorage) BaseRule{
 	//newKuidailiRule,
 	//newYundailiRule,
 	//newMianfeidaili89Rule,
@@ -15,10 +15,11 @@ var proxyFetchRuleCreators = []func() BaseRule{
 
 // https://www.kuaidaili.com/free/inha/1/
 type kuaidailiRule struct {
+	storage AbsProxyStorage
 }
 
-func newKuidailiRule() BaseRule {
-	return &kuaidailiRule{}
+func newKuidailiRule(storage AbsProxyStorage) BaseRule {
+	return &kuaidailiRule{storage: storage}
 }
 
 func (r *kuaidailiRule) InitLinks() []string {
@@ -31,7 +32,7 @@ func (r *kuaidailiRule) InitLinks() []string {
 
 func (r *kuaidailiRule) InitParse(ctx *Context) {
 	ctx.HTML("#list > table > tbody > tr", func(element *HTMLElement) {
-		tdTexts := element.ChildrenTexts("td")
+		tdTexts := element.ChildrenCleanTexts("td")
 		proxy := &Proxy{
 			Host:  tdTexts[0],
 			Port:  tdTexts[1],
@@ -43,7 +44,7 @@ func (r *kuaidailiRule) InitParse(ctx *Context) {
 			proxy.Anonymity = Transparent
 		}
 
-		err := ProxyStorageSingleton().CreateProxy(proxy)
+		err := r.storage.CreateProxy(proxy)
 		if err != nil {
 			// todo
 		}
@@ -52,10 +53,11 @@ func (r *kuaidailiRule) InitParse(ctx *Context) {
 
 // http://www.ip3366.net/?stype=1&page=1
 type yundailiRule struct {
+	storage AbsProxyStorage
 }
 
-func newYundailiRule() BaseRule {
-	return &yundailiRule{}
+func newYundailiRule(storage AbsProxyStorage) BaseRule {
+	return &yundailiRule{storage: storage}
 }
 
 func (y *yundailiRule) InitLinks() []string {
@@ -68,7 +70,7 @@ func (y *yundailiRule) InitLinks() []string {
 
 func (y *yundailiRule) InitParse(ctx *Context) {
 	ctx.HTML("#list > table > tbody > tr", func(element *HTMLElement) {
-		tds := element.ChildrenTexts("td")
+		tds := element.ChildrenCleanTexts("td")
 		proxy := &Proxy{
 			ID:    0,
 			Host:  tds[0],
@@ -80,7 +82,7 @@ func (y *yundailiRule) InitParse(ctx *Context) {
 		} else {
 			proxy.Anonymity = Transparent
 		}
-		err := ProxyStorageSingleton().CreateProxy(proxy)
+		err := y.storage.CreateProxy(proxy)
 		if err != nil {
 			// todo
 		}
@@ -89,10 +91,11 @@ func (y *yundailiRule) InitParse(ctx *Context) {
 
 // http://www.89ip.cn/index_1.html
 type mianfeidaili89Rule struct {
+	storage AbsProxyStorage
 }
 
-func newMianfeidaili89Rule() BaseRule {
-	return &mianfeidaili89Rule{}
+func newMianfeidaili89Rule(storage AbsProxyStorage) BaseRule {
+	return &mianfeidaili89Rule{storage: storage}
 }
 
 func (m *mianfeidaili89Rule) InitLinks() []string {
@@ -105,18 +108,14 @@ func (m *mianfeidaili89Rule) InitLinks() []string {
 
 func (m *mianfeidaili89Rule) InitParse(ctx *Context) {
 	ctx.HTML("div.layui-row.layui-col-space15 > div.layui-col-md8 > div > div.layui-form > table > tbody > tr", func(element *HTMLElement) {
-		tds := element.ChildrenTexts("td")
-		for i := range tds {
-			tds[i] = strings.TrimSpace(tds[i])
-		}
-
+		tds := element.ChildrenCleanTexts("td")
 		proxy := &Proxy{
 			Host:      tds[0],
 			Port:      tds[1],
 			HTTPS:     false,
 			Anonymity: Transparent,
 		}
-		err := ProxyStorageSingleton().CreateProxy(proxy)
+		err := m.storage.CreateProxy(proxy)
 		if err != nil {
 			// todo
 		}
@@ -126,6 +125,7 @@ func (m *mianfeidaili89Rule) InitParse(ctx *Context) {
 // http://www.goubanjia.com/
 // todo 端口号是假的 需要查看 js 部分
 type quanwangdailiRule struct {
+	storage AbsProxyStorage
 }
 
 func (r *quanwangdailiRule) InitLinks() []string {
@@ -140,10 +140,11 @@ func (r *quanwangdailiRule) InitParse(ctx *Context) {
 
 // http://www.kxdaili.com/dailiip/1/1.html
 type kaixindailiRule struct {
+	storage AbsProxyStorage
 }
 
-func newKaixindailiRule() BaseRule {
-	return &kaixindailiRule{}
+func newKaixindailiRule(storage AbsProxyStorage) BaseRule {
+	return &kaixindailiRule{storage: storage}
 }
 
 func (r *kaixindailiRule) InitLinks() []string {
@@ -156,7 +157,7 @@ func (r *kaixindailiRule) InitLinks() []string {
 
 func (r *kaixindailiRule) InitParse(ctx *Context) {
 	ctx.HTML("body > div.banner-box > div.header-container > div.domain-block.price-block > div.auto > div.hot-product > div.hot-product-content > table > tbody > tr", func(element *HTMLElement) {
-		tds := element.ChildrenTexts("td")
+		tds := element.ChildrenCleanTexts("td")
 		proxy := &Proxy{
 			Host:  tds[0],
 			Port:  tds[1],
@@ -167,7 +168,7 @@ func (r *kaixindailiRule) InitParse(ctx *Context) {
 		} else {
 			proxy.Anonymity = Transparent
 		}
-		err := ProxyStorageSingleton().CreateProxy(proxy)
+		err := r.storage.CreateProxy(proxy)
 		if err != nil {
 			// todo
 		}
@@ -177,11 +178,12 @@ func (r *kaixindailiRule) InitParse(ctx *Context) {
 // https://ip.ihuan.me/
 // todo 抓的太慢放弃
 type xiaohuandailiRule struct {
-	cnt int
+	storage AbsProxyStorage
+	cnt     int
 }
 
-func newXiaohuandailiRule() BaseRule {
-	return &xiaohuandailiRule{}
+func newXiaohuandailiRule(storage AbsProxyStorage) BaseRule {
+	return &xiaohuandailiRule{storage: storage}
 }
 
 func (r *xiaohuandailiRule) InitLinks() []string {
@@ -190,8 +192,7 @@ func (r *xiaohuandailiRule) InitLinks() []string {
 
 func (r *xiaohuandailiRule) InitParse(ctx *Context) {
 	ctx.HTML("div.col-md-10 > div.table-responsive > table > tbody > tr", func(element *HTMLElement) {
-		tds := element.ChildrenTexts("td")
-		tds = trimStrings(tds)
+		tds := element.ChildrenCleanTexts("td")
 		proxy := &Proxy{
 			ID:    0,
 			Host:  tds[0],
@@ -205,29 +206,7 @@ func (r *xiaohuandailiRule) InitParse(ctx *Context) {
 		} else {
 			proxy.Anonymity = Transparent
 		}
-		ProxyStorageSingleton().CreateProxy(proxy)
-	})
-	ctx.HTML("div.col-md-10 > nav > ul", func(element *HTMLElement) {
-		link := element.MayChildAttr("a[aria-label=Next]", "href")
-		if link != "" {
-			val, ok := ctx.Get("CNT")
-			var cnt int
-			if !ok {
-				cnt = 1
-			} else {
-				cnt = val.(int)
-			}
-			if cnt < 5 {
-				ctx.Follow(link, r.InitParse, H{"CNT": cnt + 1})
-			}
-		}
+		r.storage.CreateProxy(proxy)
 	})
-}
-
-func trimStrings(strs []string) []string {
-	rets := make([]string, 0, len(strs))
-	for i := range strs {
-		rets = append(rets, strings.TrimSpace(strs[i]))
-	}
-	return rets
+	ctx.Paginate("div.col-md-10 > nav > ul a[aria-label=Next]", r.InitParse, 5)
 }
@@ -7,19 +7,17 @@ import (
 )
 
 func TestProxyRules(t *testing.T) {
-	dbStorageOnce.Do(func() {
-		absStorageSingleton = &dbStorageForProxyRuleTest{}
-	})
+	storage := &dbStorageForProxyRuleTest{}
 	data := []struct {
 		rule     BaseRule
 		filename string
 	}{
-		{&kuaidailiRule{}, "kuaidaili.html"},
-		{&yundailiRule{}, "yundaili.html"},
-		{&mianfeidaili89Rule{}, "89ip.html"},
-		//{&quanwangdailiRule{}, "quanwangdaili.html"},
-		{&kaixindailiRule{}, "kaixindaili.html"},
-		{&xiaohuandailiRule{}, "xiaohuandaili.html"},
+		{&kuaidailiRule{storage: storage}, "kuaidaili.html"},
+		{&yundailiRule{storage: storage}, "yundaili.html"},
+		{&mianfeidaili89Rule{storage: storage}, "89ip.html"},
+		//{&quanwangdailiRule{storage: storage}, "quanwangdaili.html"},
+		{&kaixindailiRule{storage: storage}, "kaixindaili.html"},
+		{&xiaohuandailiRule{storage: storage}, "xiaohuandaili.html"},
 	}
 	suit := NewTestSuits(t)
 	for _, datum := range data {
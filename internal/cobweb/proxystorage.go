@@ -3,7 +3,8 @@ package cobweb
 import (
 	"fmt"
 	"math/rand"
-	"sync"
+	"os"
+	"path"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
@@ -27,40 +28,49 @@ type AbsProxyStorage interface {
 	GetRandProxyWithRefuseList([]*Proxy) (*Proxy, error)
 }
 
-var absStorageSingleton AbsProxyStorage
-var dbStorageOnce sync.Once
+const (
+	DefaultProxyStorageDialect = "sqlite3"
+	DefaultProxyStorageDSN     = "./instance/data.db3"
+)
+
+// NewDefaultDBProxyStorage opens the sqlite database at ./instance/data.db3
+func NewDefaultDBProxyStorage() (AbsProxyStorage, error) {
+	if err := os.MkdirAll(path.Dir(DefaultProxyStorageDSN), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return NewDBProxyStorage(DefaultProxyStorageDialect, DefaultProxyStorageDSN)
+}
 
-func ProxyStorageSingleton() AbsProxyStorage {
-	dbStorageOnce.Do(func() {
-		absStorageSingleton = newDBProxyStorage()
-	})
-	return absStorageSingleton
+// NewDBProxyStorage opens a gorm database with the given dialect and dsn
+// dialect could be mysql, postgres, mssql or sqlite3
+func NewDBProxyStorage(dialect, dsn string) (AbsProxyStorage, error) {
+	return newDBProxyStorage(dialect, dsn)
 }
 
 type dbProxyStorage struct {
 	dbConn *gorm.DB
 }
 
-func newDBProxyStorage() *dbProxyStorage {
-	dialect, connURL := "sqlite3", "./instance/data.db3"
-	dbConn, err := gorm.Open(dialect, connURL)
+func newDBProxyStorage(dialect, dsn string) (*dbProxyStorage, error) {
+	dbConn, err := gorm.Open(dialect, dsn)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
-			"Error":     err,
-			"Dialect":   dialect,
-			"DBConnURL": connURL,
-		}).Fatal("建立数据库连接失败")
-		return nil
+			"Error":   err,
+			"Dialect": dialect,
+		}).Error("建立数据库连接失败")
+		return nil, err
 	}
 
 	if !dbConn.HasTable(&Proxy{}) {
 		err := dbConn.CreateTable(&Proxy{}).Error
 		if err != nil {
-			logrus.WithField("Error", err).Fatal("建立数据库表 Proxy 失败")
+			logrus.WithField("Error", err).Error("建立数据库表 Proxy 失败")
+			dbConn.Close()
+			return nil, err
 		}
 	}
 
-	return &dbProxyStorage{dbConn: dbConn}
+	return &dbProxyStorage{dbConn: dbConn}, nil
 }
 
 func (this *dbProxyStorage) GetProxy(proxy *Proxy) (*Proxy, error) {
@@ -0,0 +1,75 @@
+package cobweb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryProxyStorage(t *testing.T) {
+	storage := NewMemoryProxyStorage()
+	proxies := []*Proxy{
+		{Host: "1.1.1.1", Port: "80"},
+		{Host: "2.2.2.2", Port: "8080"},
+		{Host: "3.3.3.3", Port: "3128"},
+	}
+	assert.Equal(t, 3, storage.CreateProxyList(proxies))
+	assert.Error(t, storage.CreateProxy(&Proxy{Host: "1.1.1.1", Port: "80"}))
+
+	assert.NoError(t, storage.ActivateProxy(proxies[1]))
+	assert.NoError(t, storage.DeactivateProxy(proxies[2]))
+
+	top, err := storage.GetTopKProxyList(2)
+	assert.NoError(t, err)
+	assert.Len(t, top, 2)
+	assert.Equal(t, "2.2.2.2", top[0].Host)
+	assert.Equal(t, 100, top[0].Score)
+	assert.Equal(t, "1.1.1.1", top[1].Host)
+
+	refused, err := storage.GetProxyListWithRefuseList(proxies[:2], 10)
+	assert.NoError(t, err)
+	assert.Len(t, refused, 1)
+	assert.Equal(t, 79, refused[0].Score)
+
+	_, err = storage.GetRandProxyWithRefuseList(proxies)
+	assert.Error(t, err)
+}
+
+func TestJSONFileProxyStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cobweb")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "proxies.json")
+
+	storage, err := NewJSONFileProxyStorage(filePath)
+	assert.NoError(t, err)
+	assert.NoError(t, storage.CreateProxy(&Proxy{Host: "1.1.1.1", Port: "80"}))
+	assert.NoError(t, storage.ActivateProxy(&Proxy{Host: "1.1.1.1", Port: "80"}))
+
+	reloaded, err := NewJSONFileProxyStorage(filePath)
+	assert.NoError(t, err)
+	proxy, err := reloaded.GetProxy(&Proxy{Host: "1.1.1.1", Port: "80"})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, proxy.Score)
+
+	newProxy := &Proxy{Host: "2.2.2.2", Port: "80"}
+	assert.NoError(t, reloaded.CreateProxy(newProxy))
+	assert.Equal(t, 2, newProxy.ID)
+}
+
+func TestProxyFactoryWithoutProxy(t *testing.T) {
+	e := NewExecutor(NewMemoryProxyStorage(), NewMemoryFrontier(), &ProxyFastHTTPDownloaderFactory{}, 2, 1, 10, 0)
+	defer e.Stop()
+	assert.Equal(t, errNoProxy, e.dManager.err())
+	assert.Nil(t, e.AcceptRule(&frontierTestRule{}))
+
+	storage := NewMemoryProxyStorage()
+	storage.CreateProxyList([]*Proxy{{Host: "1.1.1.1", Port: "80"}})
+	other := NewExecutor(storage, NewMemoryFrontier(), &ProxyFastHTTPDownloaderFactory{}, 2, 1, 10, 0)
+	defer other.Stop()
+	assert.Nil(t, other.dManager.err())
+	assert.Len(t, other.dManager.(*downloaderManager).downloaderList, 1)
+}
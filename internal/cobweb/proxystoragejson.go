@@ -0,0 +1,113 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// jsonFileProxyStorage is a memoryProxyStorage which saves all proxies
+// to a json file after every modification
+type jsonFileProxyStorage struct {
+	*memoryProxyStorage
+
+	saveLocker sync.Mutex
+	filePath   string
+}
+
+// NewJSONFileProxyStorage loads proxies from filePath if it exists
+func NewJSONFileProxyStorage(filePath string) (AbsProxyStorage, error) {
+	s := &jsonFileProxyStorage{
+		memoryProxyStorage: newMemoryProxyStorage(),
+		filePath:           filePath,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (this *jsonFileProxyStorage) load() error {
+	data, err := ioutil.ReadFile(this.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	proxyList := make([]*Proxy, 0)
+	if err := json.Unmarshal(data, &proxyList); err != nil {
+		return err
+	}
+
+	for _, proxy := range proxyList {
+		proxyCopy := *proxy
+		this.proxies[this.proxyKey(proxy)] = &proxyCopy
+		if proxy.ID >= this.nextID {
+			this.nextID = proxy.ID + 1
+		}
+	}
+	return nil
+}
+
+// write all proxies to a temp file and rename it to filePath
+func (this *jsonFileProxyStorage) save() error {
+	this.saveLocker.Lock()
+	defer this.saveLocker.Unlock()
+
+	proxyList, _ := this.memoryProxyStorage.GetAllProxy()
+	data, err := json.MarshalIndent(proxyList, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(path.Dir(this.filePath), os.ModePerm); err != nil {
+		return err
+	}
+	tmpFilePath := this.filePath + ".tmp"
+	if err := ioutil.WriteFile(tmpFilePath, data, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFilePath, this.filePath); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":    err,
+			"FilePath": this.filePath,
+		}).Error("保存代理文件失败")
+		return err
+	}
+	return nil
+}
+
+func (this *jsonFileProxyStorage) CreateProxy(proxy *Proxy) error {
+	if err := this.memoryProxyStorage.CreateProxy(proxy); err != nil {
+		return err
+	}
+	return this.save()
+}
+
+func (this *jsonFileProxyStorage) CreateProxyList(proxies []*Proxy) int {
+	createCount := this.memoryProxyStorage.CreateProxyList(proxies)
+	if createCount != 0 {
+		this.save()
+	}
+	return createCount
+}
+
+func (this *jsonFileProxyStorage) ActivateProxy(proxy *Proxy) error {
+	if err := this.memoryProxyStorage.ActivateProxy(proxy); err != nil {
+		return err
+	}
+	return this.save()
+}
+
+func (this *jsonFileProxyStorage) DeactivateProxy(proxy *Proxy) error {
+	if err := this.memoryProxyStorage.DeactivateProxy(proxy); err != nil {
+		return err
+	}
+	return this.save()
+}
@@ -0,0 +1,187 @@
+package cobweb
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// memoryProxyStorage keeps proxies in process memory
+// it is useful for tests and small crawls which don't need a database
+type memoryProxyStorage struct {
+	locker  sync.RWMutex
+	nextID  int
+	proxies map[string]*Proxy
+}
+
+func NewMemoryProxyStorage() AbsProxyStorage {
+	return newMemoryProxyStorage()
+}
+
+func newMemoryProxyStorage() *memoryProxyStorage {
+	return &memoryProxyStorage{
+		nextID:  1,
+		proxies: make(map[string]*Proxy),
+	}
+}
+
+func (this *memoryProxyStorage) proxyKey(proxy *Proxy) string {
+	return fmt.Sprintf("%s:%s", proxy.Host, proxy.Port)
+}
+
+func (this *memoryProxyStorage) GetProxy(proxy *Proxy) (*Proxy, error) {
+	if proxy == nil {
+		return nil, fmt.Errorf("Proxy is nil")
+	}
+
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	proxyInMem, ok := this.proxies[this.proxyKey(proxy)]
+	if !ok {
+		return nil, fmt.Errorf("代理不存在")
+	}
+
+	proxyCopy := *proxyInMem
+	return &proxyCopy, nil
+}
+
+func (this *memoryProxyStorage) HasProxy(proxy *Proxy) (bool, error) {
+	if proxy == nil {
+		return false, fmt.Errorf("Proxy is nil")
+	}
+
+	this.locker.RLock()
+	defer this.locker.RUnlock()
+	_, ok := this.proxies[this.proxyKey(proxy)]
+	return ok, nil
+}
+
+func (this *memoryProxyStorage) CreateProxy(proxy *Proxy) error {
+	if proxy == nil {
+		return fmt.Errorf("Proxy is nil")
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	key := this.proxyKey(proxy)
+	if _, ok := this.proxies[key]; ok {
+		return fmt.Errorf("代理已经存在")
+	}
+
+	proxy.ID = this.nextID
+	proxy.Score = 80
+	this.nextID++
+
+	proxyCopy := *proxy
+	this.proxies[key] = &proxyCopy
+	return nil
+}
+
+func (this *memoryProxyStorage) CreateProxyList(proxies []*Proxy) int {
+	var createCount int = 0
+	for _, val := range proxies {
+		err := this.CreateProxy(val)
+		if err == nil {
+			createCount++
+		}
+	}
+	return createCount
+}
+
+func (this *memoryProxyStorage) ActivateProxy(proxy *Proxy) error {
+	return this.updateScore(proxy, func(score int) int {
+		return 100
+	})
+}
+
+func (this *memoryProxyStorage) DeactivateProxy(proxy *Proxy) error {
+	return this.updateScore(proxy, func(score int) int {
+		return score - 1
+	})
+}
+
+func (this *memoryProxyStorage) updateScore(proxy *Proxy, update func(score int) int) error {
+	if proxy == nil {
+		return fmt.Errorf("Proxy is nil")
+	}
+
+	this.locker.Lock()
+	defer this.locker.Unlock()
+	proxyInMem, ok := this.proxies[this.proxyKey(proxy)]
+	if !ok {
+		return fmt.Errorf("代理不存在")
+	}
+	proxyInMem.Score = update(proxyInMem.Score)
+	return nil
+}
+
+func (this *memoryProxyStorage) GetTopKProxyList(k int) ([]*Proxy, error) {
+	return this.GetProxyListWithRefuseList(nil, k)
+}
+
+func (this *memoryProxyStorage) GetRandTopKProxy(k int) (*Proxy, error) {
+	proxyList, err := this.GetTopKProxyList(k)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(proxyList) == 0 {
+		return nil, nil
+	} else {
+		return proxyList[rand.Intn(len(proxyList))], nil
+	}
+}
+
+func (this *memoryProxyStorage) GetAllProxy() ([]*Proxy, error) {
+	return this.sortedProxyList(nil), nil
+}
+
+func (this *memoryProxyStorage) GetProxyListWithRefuseList(refuseList []*Proxy, count int) ([]*Proxy, error) {
+	proxyList := this.sortedProxyList(refuseList)
+	if count < len(proxyList) {
+		proxyList = proxyList[:count]
+	}
+	return proxyList, nil
+}
+
+func (this *memoryProxyStorage) GetRandProxyWithRefuseList(refuseList []*Proxy) (*Proxy, error) {
+	proxyList, err := this.GetProxyListWithRefuseList(refuseList, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(proxyList) == 0 {
+		return nil, fmt.Errorf("没有可用的代理")
+	}
+	return proxyList[rand.Intn(len(proxyList))], nil
+}
+
+// copies of proxies whose host is not in refuseList, ordered by score desc
+func (this *memoryProxyStorage) sortedProxyList(refuseList []*Proxy) []*Proxy {
+	refuseHosts := make(map[string]struct{}, len(refuseList))
+	for _, proxy := range refuseList {
+		if proxy != nil {
+			refuseHosts[proxy.Host] = struct{}{}
+		}
+	}
+
+	this.locker.RLock()
+	proxyList := make([]*Proxy, 0, len(this.proxies))
+	for _, proxy := range this.proxies {
+		if _, refused := refuseHosts[proxy.Host]; refused {
+			continue
+		}
+		proxyCopy := *proxy
+		proxyList = append(proxyList, &proxyCopy)
+	}
+	this.locker.RUnlock()
+
+	sort.Slice(proxyList, func(i, j int) bool {
+		if proxyList[i].Score != proxyList[j].Score {
+			return proxyList[i].Score > proxyList[j].Score
+		}
+		return proxyList[i].ID < proxyList[j].ID
+	})
+	return proxyList
+}
@@ -0,0 +1,260 @@
+package cobweb
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostRateLimit limits requests sent to one host by all downloaders
+type HostRateLimit struct {
+	// requests per second
+	Rate float64
+	// requests could be sent at once
+	Burst int
+}
+
+// HostRateLimitRule overrides rate limit of hosts
+// key is host, it also matches subdomains, e.g. douban.com matches movie.douban.com
+type HostRateLimitRule interface {
+	HostRateLimits() map[string]HostRateLimit
+}
+
+// AutoThrottle adjusts delay between requests of one host
+// from observed latency and 429/503 responses,
+// rate limit of host set by HostRateLimitRule is its ceiling
+type AutoThrottle struct {
+	StartDelay time.Duration
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	// average requests sent to one host in parallel
+	TargetConcurrency float64
+}
+
+type AutoThrottleRule interface {
+	AutoThrottle() AutoThrottle
+}
+
+var DefaultAutoThrottle = AutoThrottle{
+	StartDelay:        time.Second * 5,
+	MinDelay:          time.Millisecond * 100,
+	MaxDelay:          time.Minute,
+	TargetConcurrency: 1,
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit HostRateLimit) *tokenBucket {
+	b := &tokenBucket{last: time.Now()}
+	b.setLimit(limit)
+	b.tokens = b.burst
+	return b
+}
+
+func (b *tokenBucket) setLimit(limit HostRateLimit) {
+	b.rate = limit.Rate
+	b.burst = math.Max(float64(limit.Burst), 1)
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+func (b *tokenBucket) refill(nt time.Time) {
+	if nt.Before(b.last) {
+		return
+	}
+	b.tokens = math.Min(b.burst, b.tokens+nt.Sub(b.last).Seconds()*b.rate)
+	b.last = nt
+}
+
+// time until a token could be taken
+func (b *tokenBucket) wait(nt time.Time) time.Duration {
+	b.refill(nt)
+	if b.tokens >= 1 {
+		return 0
+	}
+	if b.rate <= 0 {
+		return time.Second
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take(nt time.Time) bool {
+	b.refill(nt)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// hostRateLimiter is shared by all downloaders of downloaderManager
+type hostRateLimiter struct {
+	defaultLimit HostRateLimit
+
+	locker  sync.Mutex
+	buckets map[string]*tokenBucket
+	// delay of host computed by AutoThrottle
+	delays map[string]time.Duration
+	// no request is sent to host before this time, e.g. Retry-After
+	pausedUntil map[string]time.Time
+}
+
+// requests of one host are sent every defaultInterval by default,
+// no limit if it is zero
+func newHostRateLimiter(defaultInterval time.Duration) *hostRateLimiter {
+	l := &hostRateLimiter{
+		buckets:     make(map[string]*tokenBucket),
+		delays:      make(map[string]time.Duration),
+		pausedUntil: make(map[string]time.Time),
+	}
+	if defaultInterval > 0 {
+		l.defaultLimit = HostRateLimit{Rate: 1 / defaultInterval.Seconds(), Burst: 1}
+	} else {
+		l.defaultLimit = HostRateLimit{Rate: math.Inf(1), Burst: 1}
+	}
+	return l
+}
+
+// rate limit of host used by task
+// caller holds locker
+func (l *hostRateLimiter) limitOf(host string, task *Task) HostRateLimit {
+	if task == nil {
+		return l.defaultLimit
+	}
+	limit, limited := matchHostRateLimit(task.hostRateLimits, host)
+	if task.autoThrottle != nil {
+		delay, ok := l.delays[host]
+		if !ok {
+			delay = task.autoThrottle.StartDelay
+			l.delays[host] = delay
+		}
+		throttled := HostRateLimit{Rate: 1 / delay.Seconds(), Burst: 1}
+		if limited && limit.Rate < throttled.Rate {
+			// never faster than configured limit
+			throttled.Rate = limit.Rate
+		}
+		return throttled
+	}
+	if limited {
+		return limit
+	}
+	return l.defaultLimit
+}
+
+func matchHostRateLimit(limits map[string]HostRateLimit, host string) (HostRateLimit, bool) {
+	if limit, ok := limits[host]; ok {
+		return limit, true
+	}
+	for domain, limit := range limits {
+		if strings.HasSuffix(host, "."+domain) {
+			return limit, true
+		}
+	}
+	return HostRateLimit{}, false
+}
+
+// take a token of host, return false if requests are sent too often
+func (l *hostRateLimiter) tryAcquire(host string, task *Task) bool {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	nt := time.Now()
+	if until, ok := l.pausedUntil[host]; ok {
+		if nt.Before(until) {
+			return false
+		}
+		delete(l.pausedUntil, host)
+	}
+
+	limit := l.limitOf(host, task)
+	bucket, ok := l.buckets[host]
+	if !ok {
+		bucket = newTokenBucket(limit)
+		l.buckets[host] = bucket
+	} else {
+		bucket.setLimit(limit)
+	}
+	return bucket.take(nt)
+}
+
+// time until request of host could be sent, zero if it could be sent now
+func (l *hostRateLimiter) waitTime(host string) time.Duration {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	nt := time.Now()
+	wait := time.Duration(0)
+	if until, ok := l.pausedUntil[host]; ok && nt.Before(until) {
+		wait = until.Sub(nt)
+	}
+	if bucket, ok := l.buckets[host]; ok {
+		if bucketWait := bucket.wait(nt); bucketWait > wait {
+			wait = bucketWait
+		}
+	}
+	return wait
+}
+
+// stop sending requests to host for duration
+func (l *hostRateLimiter) pause(host string, duration time.Duration) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	until := time.Now().Add(duration)
+	if until.After(l.pausedUntil[host]) {
+		l.pausedUntil[host] = until
+	}
+}
+
+// give token back if request is not sent
+func (l *hostRateLimiter) refund(host string) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if bucket, ok := l.buckets[host]; ok {
+		bucket.tokens = math.Min(bucket.burst, bucket.tokens+1)
+	}
+}
+
+// AutoThrottle of task adjusts delay of host from download result
+//  1. 429 and 503 double the delay
+//  2. otherwise delay moves toward latency / TargetConcurrency,
+//     failed downloads and error responses never decrease the delay
+func (l *hostRateLimiter) observe(host string, task *Task, latency time.Duration, statusCode int, downloadErr error) {
+	if task == nil || task.autoThrottle == nil {
+		return
+	}
+	conf := task.autoThrottle
+
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	delay, ok := l.delays[host]
+	if !ok {
+		delay = conf.StartDelay
+	}
+
+	if statusCode == 429 || statusCode == 503 {
+		delay *= 2
+	} else {
+		targetDelay := time.Duration(float64(latency) / conf.TargetConcurrency)
+		newDelay := (delay + targetDelay) / 2
+		if newDelay > delay || (downloadErr == nil && statusCode < 400) {
+			delay = newDelay
+		}
+	}
+
+	if delay < conf.MinDelay {
+		delay = conf.MinDelay
+	} else if delay > conf.MaxDelay {
+		delay = conf.MaxDelay
+	}
+	l.delays[host] = delay
+}
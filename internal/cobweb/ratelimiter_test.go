@@ -0,0 +1,121 @@
+package cobweb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostRateLimiter(t *testing.T) {
+	l := newHostRateLimiter(time.Hour)
+	task := &Task{
+		hostRateLimits: map[string]HostRateLimit{
+			"douban.com": {Rate: 1000, Burst: 3},
+		},
+	}
+
+	assert.True(t, l.tryAcquire("example.com", task))
+	assert.False(t, l.tryAcquire("example.com", task))
+	assert.InDelta(t, float64(time.Hour), float64(l.waitTime("example.com")), float64(time.Second))
+	l.refund("example.com")
+	assert.True(t, l.tryAcquire("example.com", nil))
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.tryAcquire("movie.douban.com", task))
+	}
+	assert.False(t, l.tryAcquire("movie.douban.com", task))
+	assert.True(t, l.waitTime("movie.douban.com") <= time.Millisecond)
+	time.Sleep(time.Millisecond * 5)
+	assert.True(t, l.tryAcquire("movie.douban.com", task))
+}
+
+func TestHostRateLimiterAutoThrottle(t *testing.T) {
+	l := newHostRateLimiter(0)
+	task := &Task{
+		autoThrottle: &AutoThrottle{
+			StartDelay:        time.Second,
+			MinDelay:          time.Millisecond * 100,
+			MaxDelay:          time.Second * 3,
+			TargetConcurrency: 1,
+		},
+	}
+
+	l.observe("example.com", task, time.Millisecond*200, 200, nil)
+	assert.Equal(t, time.Millisecond*600, l.delays["example.com"])
+
+	// slow error responses increase delay, fast ones don't decrease it
+	l.observe("example.com", task, time.Millisecond, 500, nil)
+	assert.Equal(t, time.Millisecond*600, l.delays["example.com"])
+
+	l.observe("example.com", task, time.Millisecond*200, 429, nil)
+	assert.Equal(t, time.Millisecond*1200, l.delays["example.com"])
+	l.observe("example.com", task, time.Millisecond*200, 503, nil)
+	l.observe("example.com", task, time.Millisecond*200, 503, nil)
+	assert.Equal(t, time.Second*3, l.delays["example.com"])
+
+	assert.True(t, l.tryAcquire("example.com", task))
+	assert.False(t, l.tryAcquire("example.com", task))
+
+	// configured limit is ceiling of AutoThrottle
+	task.hostRateLimits = map[string]HostRateLimit{"example.com": {Rate: 0.1, Burst: 1}}
+	l.observe("example.com", task, time.Millisecond, 200, nil)
+	assert.Equal(t, 0.1, l.limitOf("example.com", task).Rate)
+	assert.Equal(t, 1.0, l.limitOf("other.com", task).Rate)
+}
+
+func TestCommandDelayQueue(t *testing.T) {
+	l := newHostRateLimiter(time.Hour)
+	assert.True(t, l.tryAcquire("a.com", nil))
+
+	out := make(chan *command, 10)
+	stop := make(chan struct{})
+	q := newCommandDelayQueue(l, out, stop)
+	cmds := []*command{{}, {}, {}}
+	q.throttle("a.com", cmds[0])
+	q.throttle("b.com", cmds[1])
+	q.throttle("b.com", cmds[2])
+
+	stopWg := sync.WaitGroup{}
+	stopWg.Add(1)
+	go q.run(&stopWg)
+	defer func() {
+		close(stop)
+		stopWg.Wait()
+	}()
+
+	// commands of host are released one by one, a.com has no token
+	assert.Equal(t, cmds[1], <-out)
+	time.Sleep(time.Millisecond * 50)
+	assert.Len(t, out, 0)
+	q.done("b.com", cmds[1])
+	assert.Equal(t, cmds[2], <-out)
+	time.Sleep(time.Millisecond * 50)
+	assert.Len(t, out, 0)
+}
+
+func TestCommandDelayQueueAfter(t *testing.T) {
+	out := make(chan *command, 10)
+	stop := make(chan struct{})
+	q := newCommandDelayQueue(newHostRateLimiter(time.Hour), out, stop)
+	late, early := &command{}, &command{}
+	q.after(late, time.Millisecond*200)
+	q.after(early, time.Millisecond*50)
+
+	stopWg := sync.WaitGroup{}
+	stopWg.Add(1)
+	go q.run(&stopWg)
+
+	start := time.Now()
+	assert.Equal(t, early, <-out)
+	assert.Equal(t, late, <-out)
+	assert.True(t, time.Since(start) >= time.Millisecond*200)
+
+	// queued command is dropped after stop, nothing is sent to closed channel
+	q.after(&command{}, time.Millisecond*50)
+	close(stop)
+	stopWg.Wait()
+	close(out)
+	time.Sleep(time.Millisecond * 100)
+}
@@ -0,0 +1,78 @@
+package cobweb
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// RedirectPolicy decides how downloader follows 3xx responses
+type RedirectPolicy struct {
+	// redirects followed at most, redirects aren't followed if it is zero
+	MaxHops int
+	// redirect to other domains is not followed and its 3xx response goes to parse stage
+	// domain also matches subdomains, every domain is allowed if it is empty
+	AllowedDomains []string
+}
+
+type RedirectPolicyRule interface {
+	RedirectPolicy() RedirectPolicy
+}
+
+var DefaultRedirectPolicy = RedirectPolicy{
+	MaxHops: 10,
+}
+
+var downloadErrTooManyRedirects = errors.New("too many redirects")
+
+func (p *RedirectPolicy) isAllowed(host string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	if index := strings.LastIndex(host, ":"); index != -1 {
+		host = host[:index]
+	}
+	for _, domain := range p.AllowedDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// download request of cmd and follow redirects by RedirectPolicy of task
+// every url visited is recorded in redirect chain of cmd
+func doRedirects(client *fasthttp.Client, cmd *command) error {
+	policy := &cmd.task.redirectPolicy
+	req, resp := cmd.request(), cmd.response()
+
+	for hops := 0; ; hops++ {
+		if err := client.DoTimeout(req, resp, cmd.timeout()); err != nil {
+			return err
+		}
+
+		location := resp.Header.Peek(fasthttp.HeaderLocation)
+		if !fasthttp.StatusCodeIsRedirect(resp.StatusCode()) || len(location) == 0 || policy.MaxHops == 0 {
+			return nil
+		}
+		if hops >= policy.MaxHops {
+			return downloadErrTooManyRedirects
+		}
+
+		uri := fasthttp.AcquireURI()
+		req.URI().CopyTo(uri)
+		uri.UpdateBytes(location)
+		if !policy.isAllowed(string(uri.Host())) {
+			logrus.WithFields(cmd.logrusFields()).WithField("Location", uri.String()).Info("redirect to not allowed domain")
+			fasthttp.ReleaseURI(uri)
+			return nil
+		}
+
+		cmd.redirected(resp.StatusCode(), uri)
+		fasthttp.ReleaseURI(uri)
+	}
+}
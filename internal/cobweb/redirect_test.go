@@ -0,0 +1,77 @@
+package cobweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type redirectTestRule struct {
+	frontierTestRule
+	policy RedirectPolicy
+}
+
+func (r *redirectTestRule) RedirectPolicy() RedirectPolicy {
+	return r.policy
+}
+
+func TestDoRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "hop", Value: "a", Path: "/"})
+		http.Redirect(w, r, "/dir/b", http.StatusFound)
+	})
+	mux.HandleFunc("/dir/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "c", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/dir/c", func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("hop")
+		fmt.Fprintf(w, "%s %s", r.Method, cookie.Value)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/offsite", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://example.com/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rule := &redirectTestRule{policy: RedirectPolicy{MaxHops: 3, AllowedDomains: []string{"127.0.0.1"}}}
+	task := newInMemoryJarTask(rule)
+	client := &fasthttp.Client{}
+
+	b := newCommandBuilder(task)
+	b.Link(server.URL + "/a")
+	cmd := b.build()
+	cmd.request().Header.SetMethod(fasthttp.MethodPost)
+	cmd.downloadStart(nil)
+	assert.Nil(t, doRedirects(client, cmd))
+	assert.Equal(t, "GET a", string(cmd.response().Body()))
+	ctx := newContext(cmd)
+	assert.Equal(t, server.URL+"/dir/c", ctx.FinalURL())
+	assert.Equal(t, []string{server.URL + "/a", server.URL + "/dir/b", server.URL + "/dir/c"}, ctx.RedirectChain())
+	assert.Equal(t, server.URL+"/a", newCommandSpec(cmd).URL)
+	assert.Equal(t, "POST", newCommandSpec(cmd).Method)
+
+	// retry downloads from the original url
+	cmd.downloadStart(nil)
+	assert.Equal(t, server.URL+"/a", cmd.request().URI().String())
+	assert.Nil(t, ctx.cmd.redirectChain)
+
+	b = newCommandBuilder(task)
+	b.Link(server.URL + "/loop")
+	cmd = b.build()
+	assert.Equal(t, downloadErrTooManyRedirects, doRedirects(client, cmd))
+
+	b = newCommandBuilder(task)
+	b.Link(server.URL + "/offsite")
+	cmd = b.build()
+	assert.Nil(t, doRedirects(client, cmd))
+	assert.Equal(t, 302, cmd.response().StatusCode())
+	assert.Equal(t, server.URL+"/offsite", newContext(cmd).FinalURL())
+}
@@ -0,0 +1,148 @@
+package cobweb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+const DefaultRedisFrontierKeyPrefix = "cobweb"
+
+func init() {
+	// context data could be nested
+	gob.Register(H{})
+}
+
+// redisFrontier stores specs, dedup sets and stats in redis
+// so executors in different processes could share them
+//
+// keys used:
+//
+//	[prefix]:queue              list of encoded specs waiting for download
+//	[prefix]:processing         list of encoded specs popped but not acked
+//	[prefix]:task:[id]:seen     set of fingerprints
+//	[prefix]:task:[id]:stats    hash of stats
+//
+// ContextData is encoded by gob, types other than builtin ones
+// have to be registered by gob.Register
+type redisFrontier struct {
+	pool      *redis.Pool
+	keyPrefix string
+}
+
+// NewRedisFrontier connects to redis server at addr, e.g. 127.0.0.1:6379
+func NewRedisFrontier(addr string, keyPrefix string) Frontier {
+	return NewRedisFrontierWithPool(&redis.Pool{
+		MaxIdle:     16,
+		IdleTimeout: time.Minute * 5,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr)
+		},
+	}, keyPrefix)
+}
+
+func NewRedisFrontierWithPool(pool *redis.Pool, keyPrefix string) Frontier {
+	if keyPrefix == "" {
+		keyPrefix = DefaultRedisFrontierKeyPrefix
+	}
+	return &redisFrontier{
+		pool:      pool,
+		keyPrefix: keyPrefix,
+	}
+}
+
+func (f *redisFrontier) queueKey() string {
+	return f.keyPrefix + ":queue"
+}
+
+func (f *redisFrontier) processingKey() string {
+	return f.keyPrefix + ":processing"
+}
+
+func (f *redisFrontier) seenKey(taskID string) string {
+	return f.keyPrefix + ":task:" + taskID + ":seen"
+}
+
+func (f *redisFrontier) statsKey(taskID string) string {
+	return f.keyPrefix + ":task:" + taskID + ":stats"
+}
+
+func (f *redisFrontier) Push(spec *CommandSpec) error {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(spec); err != nil {
+		return err
+	}
+
+	conn := f.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("LPUSH", f.queueKey(), buf.Bytes())
+	return err
+}
+
+func (f *redisFrontier) Pop(timeout time.Duration) (*CommandSpec, error) {
+	// blocking timeout of redis is in seconds, zero means forever
+	timeoutSec := int(timeout / time.Second)
+	if timeoutSec < 1 {
+		timeoutSec = 1
+	}
+
+	conn := f.pool.Get()
+	defer conn.Close()
+	raw, err := redis.Bytes(conn.Do("BRPOPLPUSH", f.queueKey(), f.processingKey(), timeoutSec))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	spec := &CommandSpec{}
+	if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(spec); err != nil {
+		conn.Do("LREM", f.processingKey(), 1, raw)
+		return nil, err
+	}
+	spec.raw = raw
+	return spec, nil
+}
+
+func (f *redisFrontier) Ack(spec *CommandSpec) error {
+	if spec == nil || spec.raw == nil {
+		return nil
+	}
+
+	conn := f.pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("LREM", f.processingKey(), 1, spec.raw)
+	return err
+}
+
+func (f *redisFrontier) AddSeen(taskID, fingerprint string) (bool, error) {
+	conn := f.pool.Get()
+	defer conn.Close()
+	added, err := redis.Int(conn.Do("SADD", f.seenKey(taskID), fingerprint))
+	if err != nil {
+		return false, err
+	}
+	return added == 1, nil
+}
+
+func (f *redisFrontier) IncrStat(taskID, key string, delta int64) (int64, error) {
+	conn := f.pool.Get()
+	defer conn.Close()
+	return redis.Int64(conn.Do("HINCRBY", f.statsKey(taskID), key, delta))
+}
+
+func (f *redisFrontier) Stats(taskID string) (map[string]int64, error) {
+	conn := f.pool.Get()
+	defer conn.Close()
+	stats, err := redis.Int64Map(conn.Do("HGETALL", f.statsKey(taskID)))
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (f *redisFrontier) Close() error {
+	return f.pool.Close()
+}
@@ -0,0 +1,136 @@
+package cobweb
+
+import (
+	"regexp"
+	"sync"
+)
+
+// patterns are compiled once, invalid pattern panics like regexp.MustCompile
+var regexpCache sync.Map
+
+func compileRegex(pattern string) *regexp.Regexp {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp)
+	}
+	re := regexp.MustCompile(pattern)
+	regexpCache.Store(pattern, re)
+	return re
+}
+
+// match of Context.Regex and HTMLElement.Regex
+type RegexMatch struct {
+	// whole match
+	Text string
+	// submatches, Groups[0] is Text, unmatched optional groups are empty
+	Groups []string
+	// submatches of named groups like (?P<name>...)
+	Named map[string]string
+}
+
+// submatch of named group, empty if pattern doesn't have it
+func (m *RegexMatch) Group(name string) string {
+	return m.Named[name]
+}
+
+func newRegexMatch(re *regexp.Regexp, groups []string) *RegexMatch {
+	match := &RegexMatch{
+		Text:   groups[0],
+		Groups: groups,
+		Named:  make(map[string]string),
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			match.Named[name] = groups[i]
+		}
+	}
+	return match
+}
+
+func regexFind(pattern string, text string) *RegexMatch {
+	re := compileRegex(pattern)
+	groups := re.FindStringSubmatch(text)
+	if groups == nil {
+		return nil
+	}
+	return newRegexMatch(re, groups)
+}
+
+func regexFindAll(pattern string, text string, callback func(match *RegexMatch)) int {
+	re := compileRegex(pattern)
+	all := re.FindAllStringSubmatch(text, -1)
+	for _, groups := range all {
+		callback(newRegexMatch(re, groups))
+	}
+	return len(all)
+}
+
+// the first match of pattern in body decoded to utf-8,
+// panic with HTMLNodeNotFoundError if body doesn't match
+func (c *Context) Regex(pattern string) *RegexMatch {
+	match := c.MayRegex(pattern)
+	if match == nil {
+		c.panicByHTMLNotFound(htmlSelectRules{}.append("regex", pattern))
+	}
+	return match
+}
+
+// nil if body doesn't match
+func (c *Context) MayRegex(pattern string) *RegexMatch {
+	return regexFind(pattern, c.Text())
+}
+
+// call callback with every match of pattern in body, panic with HTMLNodeNotFoundError if there isn't any
+func (c *Context) RegexAll(pattern string, callback func(match *RegexMatch)) int {
+	cnt := c.MayRegexAll(pattern, callback)
+	if cnt == 0 {
+		c.panicByHTMLNotFound(htmlSelectRules{}.append("regex", pattern))
+	}
+	return cnt
+}
+
+func (c *Context) MayRegexAll(pattern string, callback func(match *RegexMatch)) int {
+	return regexFindAll(pattern, c.Text(), callback)
+}
+
+// the first match of pattern in text of element, text of script element is its code
+func (e *HTMLElement) Regex(pattern string) *RegexMatch {
+	match := e.MayRegex(pattern)
+	if match == nil {
+		e.ctx.panicByHTMLNotFound(e.selectRules.append("regex", pattern))
+	}
+	return match
+}
+
+func (e *HTMLElement) MayRegex(pattern string) *RegexMatch {
+	return regexFind(pattern, e.Text())
+}
+
+func (e *HTMLElement) RegexAll(pattern string, callback func(match *RegexMatch)) int {
+	cnt := e.MayRegexAll(pattern, callback)
+	if cnt == 0 {
+		e.ctx.panicByHTMLNotFound(e.selectRules.append("regex", pattern))
+	}
+	return cnt
+}
+
+func (e *HTMLElement) MayRegexAll(pattern string, callback func(match *RegexMatch)) int {
+	return regexFindAll(pattern, e.Text(), callback)
+}
+
+// the first match of pattern in attribute key of element,
+// panic with HTMLNodeNotFoundError if element doesn't have it or it doesn't match
+func (e *HTMLElement) AttrRegex(key, pattern string) *RegexMatch {
+	match := e.MayAttrRegex(key, pattern)
+	if match == nil {
+		e.ctx.panicByHTMLNotFound(e.selectRules.append("attrname", key).append("regex", pattern))
+	}
+	return match
+}
+
+func (e *HTMLElement) MayAttrRegex(key, pattern string) *RegexMatch {
+	attr, ok := e.mayAttr(key)
+	if !ok {
+		return nil
+	}
+	return regexFind(pattern, attr)
+}
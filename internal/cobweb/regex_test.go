@@ -0,0 +1,46 @@
+package cobweb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegex(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/", `<html><body>
+<a class="item" data-id="item-12" href="/a">price: 12.5</a>
+<a class="item" data-id="item-13" href="/b">price: 8</a>
+<script>var token = "abc123";</script>
+</body></html>`)
+
+	match := ctx.Regex(`var (?P<name>\w+) = "(?P<value>\w+)"`)
+	assert.Equal(t, `var token = "abc123"`, match.Text)
+	assert.Equal(t, "token", match.Group("name"))
+	assert.Equal(t, "abc123", match.Groups[2])
+	assert.Equal(t, "", match.Group("missing"))
+	assert.Nil(t, ctx.MayRegex(`not found`))
+
+	prices := make([]string, 0)
+	cnt := ctx.RegexAll(`price: (?P<price>[\d.]+)`, func(match *RegexMatch) {
+		prices = append(prices, match.Group("price"))
+	})
+	assert.Equal(t, 2, cnt)
+	assert.Equal(t, []string{"12.5", "8"}, prices)
+
+	ids := make([]string, 0)
+	ctx.HTML("a.item", func(element *HTMLElement) {
+		assert.NotNil(t, element.Regex(`[\d.]+`))
+		ids = append(ids, element.AttrRegex("data-id", `item-(?P<id>\d+)`).Group("id"))
+		assert.Nil(t, element.MayAttrRegex("title", `.*`))
+	})
+	assert.Equal(t, []string{"12", "13"}, ids)
+
+	defer func() {
+		info := recover().(*ParseErrorInfo)
+		assert.Equal(t, HTMLNodeNotFoundError, info.ErrKind)
+		assert.Equal(t, []string{`\d{10}`}, info.PanicValue.(htmlSelectRules)["regex"])
+	}()
+	ctx.HTML("script", func(element *HTMLElement) {
+		element.RegexAll(`\d{10}`, func(match *RegexMatch) {})
+	})
+}
@@ -0,0 +1,127 @@
+package cobweb
+
+import (
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy decides whether a downloaded response is retried
+// before it goes to parse stage
+type RetryPolicy struct {
+	// responses with these status codes are retried
+	StatusCodes []int
+	// command fails after MaxAttempts downloads with retryable status,
+	// DefaultRetryPolicy.MaxAttempts if it is zero
+	MaxAttempts int
+
+	// delay before n-th retry is BaseDelay * 2^(n-1), at most MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// delay is randomly changed by at most Jitter * delay, in [0, 1]
+	Jitter float64
+
+	// use delay of Retry-After header if response has one
+	HonourRetryAfter bool
+}
+
+// responses are retried by status only if rule implements RetryPolicyRule,
+// DefaultRetryPolicy is a policy it could return
+type RetryPolicyRule interface {
+	RetryPolicy() RetryPolicy
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	StatusCodes:      []int{429, 500, 502, 503, 504},
+	MaxAttempts:      5,
+	BaseDelay:        time.Second,
+	MaxDelay:         time.Minute,
+	Jitter:           0.2,
+	HonourRetryAfter: true,
+}
+
+type retryDecision int
+
+const (
+	// response goes to parse stage
+	retryDecisionPass retryDecision = iota
+	// download again after delay
+	retryDecisionRetry
+	// command fails
+	retryDecisionGiveUp
+)
+
+func (p *RetryPolicy) isRetryableStatus(statusCode int) bool {
+	for _, code := range p.StatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// delay before attempt-th retry, attempt starts from 1
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(delay)
+}
+
+// decide what to do with downloaded command, every response passes if p is nil
+func (p *RetryPolicy) decide(cmd *command) (retryDecision, time.Duration) {
+	if p == nil {
+		return retryDecisionPass, 0
+	}
+	resp := cmd.response()
+	if !p.isRetryableStatus(resp.StatusCode()) {
+		return retryDecisionPass, 0
+	}
+
+	cmd.statusRetryCount++
+	if cmd.statusRetryCount >= p.MaxAttempts {
+		return retryDecisionGiveUp, 0
+	}
+
+	if p.HonourRetryAfter {
+		if delay, ok := parseRetryAfter(string(resp.Header.Peek("Retry-After")), time.Now()); ok {
+			if p.MaxDelay > 0 && delay > p.MaxDelay {
+				delay = p.MaxDelay
+			}
+			return retryDecisionRetry, delay
+		}
+	}
+	return retryDecisionRetry, p.backoff(cmd.statusRetryCount)
+}
+
+// Retry-After is seconds or http date
+func parseRetryAfter(val string, nt time.Time) (time.Duration, bool) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(val); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(val)
+	if err != nil {
+		return 0, false
+	}
+	delay := date.Sub(nt)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
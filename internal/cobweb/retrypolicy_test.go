@@ -0,0 +1,89 @@
+package cobweb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	nt := time.Date(2020, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("120", nt)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute*2, delay)
+
+	delay, ok = parseRetryAfter("Wed, 01 Jul 2020 12:00:30 GMT", nt)
+	assert.True(t, ok)
+	assert.Equal(t, time.Second*30, delay)
+
+	_, ok = parseRetryAfter("", nt)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon", nt)
+	assert.False(t, ok)
+}
+
+func TestRetryPolicyDecide(t *testing.T) {
+	policy := RetryPolicy{
+		StatusCodes:      []int{429, 503},
+		MaxAttempts:      3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Second * 10,
+		HonourRetryAfter: true,
+	}
+	cmd := &command{downloadResponse: &fasthttp.Response{}}
+
+	cmd.response().SetStatusCode(200)
+	decision, _ := policy.decide(cmd)
+	assert.Equal(t, retryDecisionPass, decision)
+
+	cmd.response().SetStatusCode(503)
+	decision, delay := policy.decide(cmd)
+	assert.Equal(t, retryDecisionRetry, decision)
+	assert.Equal(t, time.Second, delay)
+
+	cmd.response().SetStatusCode(429)
+	cmd.response().Header.Set("Retry-After", "3600")
+	decision, delay = policy.decide(cmd)
+	assert.Equal(t, retryDecisionRetry, decision)
+	assert.Equal(t, time.Second*10, delay)
+
+	decision, _ = policy.decide(cmd)
+	assert.Equal(t, retryDecisionGiveUp, decision)
+
+	// responses pass without policy
+	var noPolicy *RetryPolicy
+	decision, _ = noPolicy.decide(cmd)
+	assert.Equal(t, retryDecisionPass, decision)
+}
+
+type retryPolicyTestRule struct {
+	frontierTestRule
+}
+
+func (r *retryPolicyTestRule) RetryPolicy() RetryPolicy {
+	return RetryPolicy{StatusCodes: []int{503}}
+}
+
+func TestSetRetryPolicy(t *testing.T) {
+	task := &Task{}
+	task.setRetryPolicy(&frontierTestRule{})
+	assert.Nil(t, task.retryPolicy)
+
+	task.setRetryPolicy(&retryPolicyTestRule{})
+	assert.Equal(t, DefaultRetryPolicy.MaxAttempts, task.retryPolicy.MaxAttempts)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		BaseDelay: time.Second,
+		MaxDelay:  time.Second * 5,
+		Jitter:    0.5,
+	}
+	for attempt := 1; attempt < 10; attempt++ {
+		delay := policy.backoff(attempt)
+		assert.True(t, delay >= time.Millisecond*500 && delay <= time.Millisecond*7500, delay)
+	}
+}
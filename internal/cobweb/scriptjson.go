@@ -0,0 +1,278 @@
+package cobweb
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/robertkrimen/otto"
+)
+
+const jsonLDSelector = `script[type="application/ld+json"]`
+
+var (
+	errScriptJSONNotFound = errors.New("json of script isn't found")
+	errScriptJSONInvalid  = errors.New("value assigned isn't an object or array")
+
+	// window.X, X.Y or X
+	scriptVarNameRegexp = regexp.MustCompile(`^(?:window\.)?[A-Za-z_$][\w$]*(?:\.[A-Za-z_$][\w$]*)*$`)
+)
+
+// decode JSON of script found by selectorOrVarName into v
+//
+//	ctx.ScriptJSON("#__NEXT_DATA__", &data)
+//	ctx.ScriptJSON(`script[type="application/ld+json"]`, &data)
+//	ctx.ScriptJSON("window.__INITIAL_STATE__", &state)
+//
+// selectorOrVarName is a selector of script elements at first, json of the first one is decoded,
+// it is a variable assigned in inline scripts if no script element is selected,
+// JSON.parse("...") and object literals which aren't strict JSON are supported
+// panic with HTMLNodeNotFoundError if it isn't found, ParseJSONError if it is malformed
+func (c *Context) ScriptJSON(selectorOrVarName string, v interface{}) {
+	err := c.MayScriptJSON(selectorOrVarName, v)
+	switch err {
+	case nil:
+	case errScriptJSONNotFound:
+		c.panicByHTMLNotFound(htmlSelectRules{}.append("script", selectorOrVarName))
+	default:
+		panic(&ParseErrorInfo{
+			Ctx:        c,
+			ErrKind:    ParseJSONError,
+			PanicValue: err,
+		})
+	}
+}
+
+func (c *Context) MayScriptJSON(selectorOrVarName string, v interface{}) error {
+	doc, err := c.MayDoc()
+	if err != nil {
+		return err
+	}
+
+	if matcher, err := cascadia.Compile(selectorOrVarName); err == nil {
+		if scripts := doc.FindMatcher(matcher); scripts.Length() != 0 {
+			return json.Unmarshal([]byte(strings.TrimSpace(scripts.First().Text())), v)
+		}
+	}
+	if !scriptVarNameRegexp.MatchString(selectorOrVarName) {
+		return errScriptJSONNotFound
+	}
+
+	name := strings.TrimPrefix(selectorOrVarName, "window.")
+	assignRegexp := regexp.MustCompile(`(?:^|[^\w$.])(?:window\.)?` + regexp.QuoteMeta(name) + `\s*=\s*`)
+	// assignments which aren't json, e.g. X = X || {}, are skipped,
+	// error of the last one is returned if none is decoded
+	err = errScriptJSONNotFound
+	var raw json.RawMessage
+	doc.Find("script:not([src])").EachWithBreak(func(_ int, script *goquery.Selection) bool {
+		text := script.Text()
+		for _, loc := range assignRegexp.FindAllStringIndex(text, -1) {
+			if raw, err = decodeAssignedJSON(text[loc[1]:]); err == nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// json of value at the beginning of js
+func decodeAssignedJSON(js string) (json.RawMessage, error) {
+	var raw json.RawMessage
+	if strings.HasPrefix(js, "JSON.parse(") {
+		literal, ok := scanJSLiteral(strings.TrimSpace(js[len("JSON.parse("):]))
+		if !ok {
+			return nil, errScriptJSONInvalid
+		}
+		var data string
+		if err := evalJSLiteral(literal, &data); err != nil {
+			return nil, err
+		}
+		err := json.Unmarshal([]byte(data), &raw)
+		return raw, err
+	}
+
+	literal, ok := scanJSLiteral(js)
+	if !ok {
+		return nil, errScriptJSONInvalid
+	}
+	if err := json.Unmarshal([]byte(literal), &raw); err == nil {
+		return raw, nil
+	}
+	// object literal with unquoted keys, single quoted strings, undefined and so on
+	var data string
+	if err := evalJSLiteral("JSON.stringify("+literal+")", &data); err != nil {
+		return nil, err
+	}
+	err := json.Unmarshal([]byte(data), &raw)
+	return raw, err
+}
+
+// object, array or string literal at the beginning of js
+// brackets are matched outside of strings only, comments and regex literals aren't recognized,
+// so brackets or quotes in them end literal at a wrong place
+func scanJSLiteral(js string) (string, bool) {
+	if js == "" {
+		return "", false
+	}
+	switch js[0] {
+	case '{', '[':
+	case '"', '\'':
+		end := scanJSString(js, 0)
+		return js[:end], end != -1
+	default:
+		return "", false
+	}
+
+	depth := 0
+	for i := 0; i < len(js); i++ {
+		switch js[i] {
+		case '"', '\'', '`':
+			end := scanJSString(js, i)
+			if end == -1 {
+				return "", false
+			}
+			i = end - 1
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return js[:i+1], true
+			}
+		}
+	}
+	return "", false
+}
+
+// end of string literal starting at index start, -1 if it isn't closed
+func scanJSString(js string, start int) int {
+	quote := js[start]
+	for i := start + 1; i < len(js); i++ {
+		switch js[i] {
+		case '\\':
+			i++
+		case quote:
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// evaluate literal without DOM shim in DefaultScriptTimeout
+func evalJSLiteral(literal string, v *string) error {
+	vm := otto.New()
+	vm.SetStackDepthLimit(DefaultScriptStackDepth)
+	var evalErr error
+	if err := runWithTimeout(vm, DefaultScriptTimeout, func() {
+		value, err := vm.Run("(" + literal + ")")
+		if err != nil {
+			evalErr = err
+			return
+		}
+		*v, evalErr = value.ToString()
+	}); err != nil {
+		return err
+	}
+	return evalErr
+}
+
+// JSONLDObject is a node of schema.org JSON-LD
+type JSONLDObject struct {
+	// @type of node, it is an array if node has several types
+	Types []string
+	ID    string
+	// every property of node, including @context, @type and @id
+	Properties map[string]interface{}
+
+	raw json.RawMessage
+}
+
+// type of node is t, t is short name like Product or full name like https://schema.org/Product
+func (o *JSONLDObject) Is(t string) bool {
+	for _, nodeType := range o.Types {
+		if nodeType == t || shortSchemaType(nodeType) == shortSchemaType(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// decode node into v, which is usually a struct with json tags of schema.org properties
+func (o *JSONLDObject) Decode(v interface{}) error {
+	return json.Unmarshal(o.raw, v)
+}
+
+func shortSchemaType(t string) string {
+	if index := strings.LastIndexAny(t, "/:#"); index != -1 {
+		return t[index+1:]
+	}
+	return t
+}
+
+// top-level nodes of every JSON-LD script of page, nodes of @graph are flattened
+// nodes of types are returned only if types are given, malformed scripts are skipped
+func (c *Context) JSONLD(types ...string) []*JSONLDObject {
+	doc, err := c.MayDoc()
+	if err != nil {
+		c.panicByHTMLParseError(err)
+	}
+
+	objects := make([]*JSONLDObject, 0)
+	doc.Find(jsonLDSelector).Each(func(_ int, script *goquery.Selection) {
+		for _, object := range parseJSONLD([]byte(strings.TrimSpace(script.Text()))) {
+			if len(types) == 0 {
+				objects = append(objects, object)
+				continue
+			}
+			for _, t := range types {
+				if object.Is(t) {
+					objects = append(objects, object)
+					break
+				}
+			}
+		}
+	})
+	return objects
+}
+
+func parseJSONLD(data []byte) []*JSONLDObject {
+	var nodes []json.RawMessage
+	if err := json.Unmarshal(data, &nodes); err != nil {
+		nodes = []json.RawMessage{data}
+	}
+
+	objects := make([]*JSONLDObject, 0, len(nodes))
+	for _, node := range nodes {
+		properties := make(map[string]interface{})
+		if err := json.Unmarshal(node, &properties); err != nil {
+			continue
+		}
+		if graph, ok := properties["@graph"]; ok {
+			graphData, _ := json.Marshal(graph)
+			objects = append(objects, parseJSONLD(graphData)...)
+			continue
+		}
+
+		object := &JSONLDObject{Properties: properties, raw: node}
+		switch t := properties["@type"].(type) {
+		case string:
+			object.Types = []string{t}
+		case []interface{}:
+			for _, item := range t {
+				if s, ok := item.(string); ok {
+					object.Types = append(object.Types, s)
+				}
+			}
+		}
+		object.ID, _ = properties["@id"].(string)
+		objects = append(objects, object)
+	}
+	return objects
+}
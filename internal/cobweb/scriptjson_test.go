@@ -0,0 +1,106 @@
+package cobweb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScriptJSON(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/", `<html><head>
+<script id="__NEXT_DATA__" type="application/json">{"props": {"page": 2}}</script>
+<script>
+	var config = {a: 'b'};
+	window.__INITIAL_STATE__ = {"list": [{"title": "a } ]"}], "total": 1};
+	window.__DATA__=JSON.parse("{\"id\":\"7\"}");
+	var broken = {"a": ;
+</script>
+<script>
+	window.__STATE__ = window.__STATE__ || {};
+	if (__STATE__ == null) {}
+</script>
+<script>window.__STATE__ = {"user": "u1"};</script>
+</head></html>`)
+
+	var next struct {
+		Props struct {
+			Page int `json:"page"`
+		} `json:"props"`
+	}
+	ctx.ScriptJSON("#__NEXT_DATA__", &next)
+	assert.Equal(t, 2, next.Props.Page)
+
+	var state struct {
+		List []struct {
+			Title string `json:"title"`
+		} `json:"list"`
+		Total int `json:"total"`
+	}
+	ctx.ScriptJSON("window.__INITIAL_STATE__", &state)
+	assert.Equal(t, "a } ]", state.List[0].Title)
+	assert.Equal(t, 1, state.Total)
+
+	data := map[string]string{}
+	assert.Nil(t, ctx.MayScriptJSON("__DATA__", &data))
+	assert.Equal(t, "7", data["id"])
+	assert.Nil(t, ctx.MayScriptJSON("config", &data))
+	assert.Equal(t, "b", data["a"])
+	// assignments which aren't json are skipped
+	assert.Nil(t, ctx.MayScriptJSON("__STATE__", &data))
+	assert.Equal(t, "u1", data["user"])
+	// json of the first assignment is decoded into v once, error of decoding is returned
+	var mismatched map[string]int
+	assert.NotNil(t, ctx.MayScriptJSON("__INITIAL_STATE__", &mismatched))
+
+	assert.Equal(t, errScriptJSONNotFound, ctx.MayScriptJSON("window.missing", &data))
+	assert.NotNil(t, ctx.MayScriptJSON("broken", &data))
+	func() {
+		defer func() {
+			info := recover().(*ParseErrorInfo)
+			assert.Equal(t, HTMLNodeNotFoundError, info.ErrKind)
+		}()
+		ctx.ScriptJSON("#missing", &data)
+	}()
+	func() {
+		defer func() {
+			info := recover().(*ParseErrorInfo)
+			assert.Equal(t, ParseJSONError, info.ErrKind)
+		}()
+		ctx.ScriptJSON("broken", &data)
+	}()
+}
+
+func TestJSONLD(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/", `<html><head>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Product", "name": "Phone", "offers": {"@type": "Offer", "price": "99"}}
+</script>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+	{"@type": ["Article", "NewsArticle"], "@id": "#article", "headline": "News"},
+	{"@type": "schema:BreadcrumbList"}
+]}
+</script>
+<script type="application/ld+json">{malformed</script>
+</head></html>`)
+
+	assert.Len(t, ctx.JSONLD(), 3)
+	assert.Len(t, ctx.JSONLD("BreadcrumbList"), 1)
+
+	articles := ctx.JSONLD("https://schema.org/NewsArticle")
+	assert.Len(t, articles, 1)
+	assert.Equal(t, "#article", articles[0].ID)
+	assert.Equal(t, "News", articles[0].Properties["headline"])
+
+	var product struct {
+		Name   string `json:"name"`
+		Offers struct {
+			Price string `json:"price"`
+		} `json:"offers"`
+	}
+	products := ctx.JSONLD("Product")
+	assert.Len(t, products, 1)
+	assert.Nil(t, products[0].Decode(&product))
+	assert.Equal(t, "Phone", product.Name)
+	assert.Equal(t, "99", product.Offers.Price)
+}
@@ -0,0 +1,222 @@
+package cobweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+// SitemapFilter of urls found in sitemaps
+type SitemapFilter struct {
+	// urls and sitemaps modified before it are skipped, no limit if it is zero
+	// urls without lastmod are always followed
+	Since time.Time
+	// url has to match one of regular expressions if it isn't empty
+	Patterns []string
+}
+
+// SitemapRule seeds task by sitemaps besides InitLinks
+type SitemapRule interface {
+	// urls of sitemap.xml, sitemap index or robots.txt whose Sitemap lines are used
+	Sitemaps() []string
+	SitemapFilter() SitemapFilter
+	// parse urls found in sitemaps
+	SitemapParse(ctx *Context)
+}
+
+// context data of sitemap commands, it has to be saved in frontier
+const (
+	sitemapCallbackKey = "Cobweb-SitemapCallback"
+	sitemapSinceKey    = "Cobweb-SitemapSince"
+	sitemapPatternsKey = "Cobweb-SitemapPatterns"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapURL `xml:"url"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// formats of W3C datetime used by lastmod
+var sitemapTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseSitemapTime(val string) (time.Time, bool) {
+	val = strings.TrimSpace(val)
+	for _, layout := range sitemapTimeLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// sitemap urls listed in robots.txt
+func parseRobotsSitemaps(body []byte) []string {
+	links := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		index := strings.Index(line, ":")
+		if index == -1 || !strings.EqualFold(strings.TrimSpace(line[:index]), "sitemap") {
+			continue
+		}
+		if link := strings.TrimSpace(line[index+1:]); link != "" {
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// sitemap files may be gzipped without Content-Encoding
+func parseSitemap(body []byte) (*sitemapDocument, error) {
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		var err error
+		if body, err = fasthttp.AppendGunzipBytes(nil, body); err != nil {
+			return nil, err
+		}
+	}
+	doc := &sitemapDocument{}
+	if err := xml.Unmarshal(body, doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func sitemapData(callbackName string, filter SitemapFilter) H {
+	data := H{
+		sitemapCallbackKey: callbackName,
+		sitemapPatternsKey: strings.Join(filter.Patterns, "\n"),
+	}
+	if !filter.Since.IsZero() {
+		data[sitemapSinceKey] = filter.Since.Format(time.RFC3339)
+	}
+	return data
+}
+
+// filter saved in context data by sitemapData
+func sitemapFilterOf(ctx *Context) (SitemapFilter, []*regexp.Regexp, error) {
+	filter := SitemapFilter{}
+	if since, ok := ctx.data[sitemapSinceKey].(string); ok {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return filter, nil, err
+		}
+		filter.Since = t
+	}
+
+	patterns := make([]*regexp.Regexp, 0)
+	if val, ok := ctx.data[sitemapPatternsKey].(string); ok && val != "" {
+		filter.Patterns = strings.Split(val, "\n")
+		for _, pattern := range filter.Patterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return filter, nil, err
+			}
+			patterns = append(patterns, re)
+		}
+	}
+	return filter, patterns, nil
+}
+
+// follow urls of sitemap at link by callback, sitemap indexes are followed recursively
+// link may be robots.txt, sitemaps listed in it are followed
+// callback is found by its name, it can't be a closure since closures of one literal have the same name
+func (c *Context) FollowSitemap(link string, callback OnParseCallback, filter ...SitemapFilter) {
+	if isClosure(callback) {
+		c.panicByBadUsage(fmt.Errorf("sitemap callback %v can't be a closure", callbackName(callback)))
+	}
+	fBuilder := c.NewFollowBuilder()
+	switch len(filter) {
+	case 1:
+		fBuilder.ContextData(sitemapData(c.cmd.task.registerCallback(callback), filter[0]))
+	case 0:
+		fBuilder.ContextData(sitemapData(c.cmd.task.registerCallback(callback), SitemapFilter{}))
+	default:
+		c.panicByBadUsage(fmt.Errorf("argument filter len %v large than 1", len(filter)))
+	}
+	c.FollowWithBuilder(link, sitemapCallback, fBuilder)
+}
+
+func sitemapCallback(ctx *Context) {
+	if ctx.cmd.response().StatusCode() != 200 {
+		logrus.WithFields(ctx.logrusFields()).WithField("StatusCode", ctx.cmd.response().StatusCode()).Warn("download sitemap failed")
+		return
+	}
+	callbackName, _ := ctx.data[sitemapCallbackKey].(string)
+	callback := ctx.cmd.task.callbackByName(callbackName)
+	filter, patterns, err := sitemapFilterOf(ctx)
+	if callback == nil || err != nil {
+		logrus.WithFields(ctx.logrusFields()).WithField("Error", err).Error("invalid sitemap context data")
+		return
+	}
+
+	if strings.HasSuffix(string(ctx.cmd.request().URI().Path()), "/robots.txt") {
+		for _, link := range parseRobotsSitemaps(ctx.RawBody()) {
+			ctx.FollowSitemap(link, callback, filter)
+		}
+		return
+	}
+
+	doc, err := parseSitemap(ctx.RawBody())
+	if err != nil {
+		logrus.WithFields(ctx.logrusFields()).WithField("Error", err).Error("parse sitemap failed")
+		return
+	}
+	for _, sitemap := range doc.Sitemaps {
+		if sitemapModified(sitemap, filter.Since) {
+			ctx.FollowSitemap(strings.TrimSpace(sitemap.Loc), callback, filter)
+		}
+	}
+
+	// context data of sitemap is passed on without sitemap keys
+	data := ctx.data.clone()
+	delete(data, sitemapCallbackKey)
+	delete(data, sitemapSinceKey)
+	delete(data, sitemapPatternsKey)
+	for _, entry := range doc.URLs {
+		link := strings.TrimSpace(entry.Loc)
+		if link == "" || !sitemapModified(entry, filter.Since) || !matchAny(patterns, link) {
+			continue
+		}
+		fBuilder := &FollowBuilder{newCommandBuilder(ctx.cmd.task)}
+		fBuilder.ContextData(data)
+		ctx.FollowWithBuilder(link, callback, fBuilder)
+	}
+}
+
+func sitemapModified(entry sitemapURL, since time.Time) bool {
+	if since.IsZero() || entry.LastMod == "" {
+		return true
+	}
+	lastMod, ok := parseSitemapTime(entry.LastMod)
+	return !ok || !lastMod.Before(since)
+}
+
+func matchAny(patterns []*regexp.Regexp, link string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package cobweb
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+)
+
+type sitemapTestRule struct {
+	frontierTestRule
+	sitemaps []string
+}
+
+func (r *sitemapTestRule) InitLinks() []string {
+	return nil
+}
+
+func (r *sitemapTestRule) Sitemaps() []string {
+	return r.sitemaps
+}
+
+func (r *sitemapTestRule) SitemapFilter() SitemapFilter {
+	return SitemapFilter{
+		Since:    time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		Patterns: []string{`/movie/\d+$`},
+	}
+}
+
+func (r *sitemapTestRule) SitemapParse(ctx *Context) {
+}
+
+func TestSitemap(t *testing.T) {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /admin\nSitemap: %s/sitemap_index.xml\n", server.URL)
+	})
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/sitemap1.xml.gz</loc><lastmod>2022-03-01</lastmod></sitemap>
+	<sitemap><loc>%[1]s/old.xml</loc><lastmod>2021-03-01T10:00:00+08:00</lastmod></sitemap>
+</sitemapindex>`, server.URL)
+	})
+	mux.HandleFunc("/sitemap1.xml.gz", func(w http.ResponseWriter, r *http.Request) {
+		body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%[1]s/movie/1</loc><lastmod>2022-02-01T00:00:00Z</lastmod></url>
+	<url><loc>%[1]s/movie/2</loc><lastmod>2021-02-01</lastmod></url>
+	<url><loc>%[1]s/movie/3</loc></url>
+	<url><loc>%[1]s/about</loc></url>
+</urlset>`, server.URL)
+		w.Write(fasthttp.AppendGzipBytes(nil, []byte(body)))
+	})
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	rule := &sitemapTestRule{sitemaps: []string{server.URL + "/robots.txt"}}
+	task := newInMemoryJarTask(rule)
+
+	cmds := task.initCommands()
+	followed := make([]string, 0)
+	for len(cmds) != 0 {
+		cmd := cmds[0]
+		cmds = cmds[1:]
+		if callbackName(cmd.onParseCallback) != callbackName(sitemapCallback) {
+			assert.Equal(t, callbackName(SitemapRule(rule).SitemapParse), callbackName(cmd.onParseCallback))
+			assert.NotContains(t, cmd.contextData, sitemapCallbackKey)
+			followed = append(followed, cmd.request().URI().String())
+			continue
+		}
+		cmd.downloadStart(nil)
+		cmd.downloadFinish(doRedirects(&fasthttp.Client{}, cmd))
+		ctx := newContext(cmd)
+		sitemapCallback(ctx)
+		cmds = append(cmds, ctx.commands()...)
+	}
+	sort.Strings(followed)
+	assert.Equal(t, []string{server.URL + "/movie/1", server.URL + "/movie/3"}, followed)
+}
+
+func TestSitemapCallbackName(t *testing.T) {
+	rule := &sitemapTestRule{}
+	assert.False(t, isClosure(rule.SitemapParse))
+	assert.False(t, isClosure(sitemapCallback))
+	assert.True(t, isClosure(func(ctx *Context) {}))
+
+	// bad usage fails command by parse error flow
+	ctx := NewTestSuits(t).ContextWithString("http://example.com/", "")
+	assertBadUsage := func(follow func()) {
+		defer func() {
+			info, ok := recover().(*ParseErrorInfo)
+			assert.True(t, ok)
+			assert.Equal(t, UnknownParseError, info.ErrKind)
+		}()
+		follow()
+	}
+	assertBadUsage(func() {
+		ctx.FollowSitemap("/sitemap.xml", func(ctx *Context) {})
+	})
+	assertBadUsage(func() {
+		ctx.FollowSitemap("/sitemap.xml", rule.SitemapParse, SitemapFilter{}, SitemapFilter{})
+	})
+	assert.Empty(t, ctx.commands())
+}
+
+func TestParseSitemapTime(t *testing.T) {
+	for _, val := range []string{"2022-03-01", "2022-03-01T08:00+08:00", "2022-03-01T00:00:00Z", " 2022-03-01T08:00:00+08:00 "} {
+		tm, ok := parseSitemapTime(val)
+		assert.True(t, ok, val)
+		assert.True(t, tm.Equal(time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)), val)
+	}
+}
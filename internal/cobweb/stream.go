@@ -0,0 +1,330 @@
+package cobweb
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	downloadErrContentLength    = errors.New("size of downloaded body doesn't match Content-Length")
+	downloadErrChecksumMismatch = errors.New("checksum of downloaded body doesn't match")
+	downloadErrStreamIdle       = errors.New("no data received in download timeout")
+)
+
+// body of error response read into fasthttp response at most
+const streamErrorBodyLimit = 1 << 20
+
+// streamOptions of command which writes response body to file
+// instead of fasthttp response buffer
+type streamOptions struct {
+	// relative to task folder
+	fileName string
+	// larger resource is not saved, no limit if it is zero
+	maxSize int64
+	// md5, sha1 or sha256
+	checksumAlgo string
+	checksum     string
+
+	// set by download
+	tooLarge bool
+}
+
+func (o *streamOptions) newHash() (hash.Hash, error) {
+	switch strings.ToLower(o.checksumAlgo) {
+	case "":
+		return nil, nil
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %s", o.checksumAlgo)
+	}
+}
+
+// net/http client used by stream download, fasthttp client always buffers body
+func newStreamClient(proxy *Proxy) *http.Client {
+	transport := &http.Transport{
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     time.Minute,
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(&url.URL{
+			Scheme: "http",
+			Host:   fmt.Sprintf("%s:%s", proxy.Host, proxy.Port),
+		})
+	}
+	return &http.Client{Transport: transport}
+}
+
+// idleReader cancels request if no data is read in timeout
+type idleReader struct {
+	reader io.Reader
+	timer  *time.Timer
+	// timeout set by last read
+	timeout time.Duration
+
+	locker sync.Mutex
+	idle   bool
+}
+
+func newIdleReader(reader io.Reader, timeout time.Duration, cancel context.CancelFunc) *idleReader {
+	r := &idleReader{reader: reader, timeout: timeout}
+	r.timer = time.AfterFunc(timeout, func() {
+		r.locker.Lock()
+		r.idle = true
+		r.locker.Unlock()
+		cancel()
+	})
+	return r
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.timer.Reset(r.timeout)
+	if err != nil {
+		r.locker.Lock()
+		defer r.locker.Unlock()
+		if r.idle {
+			return n, downloadErrStreamIdle
+		}
+	}
+	return n, err
+}
+
+func (r *idleReader) stop() {
+	r.timer.Stop()
+}
+
+// download resource of cmd to [task folder]/[fileName]
+// body is written to [fileName].part first, it is resumed by Range request
+// if the part file exists, and renamed to fileName when it is complete
+func streamDownload(client *http.Client, cmd *command) error {
+	opts := cmd.stream
+	opts.tooLarge = false
+	filePath := path.Join(cmd.task.folderPath(), opts.fileName)
+	partPath := filePath + ".part"
+
+	if err := os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+		return err
+	}
+	part, err := os.OpenFile(partPath, os.O_CREATE|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	defer part.Close()
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := newStreamRequest(ctx, cmd, offset)
+	if err != nil {
+		return err
+	}
+
+	policy := &cmd.task.redirectPolicy
+	redirectClient := *client
+	redirectClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > policy.MaxHops {
+			return downloadErrTooManyRedirects
+		}
+		if !policy.isAllowed(req.URL.Host) {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+
+	timer := time.AfterFunc(cmd.timeout(), cancel)
+	resp, err := redirectClient.Do(req)
+	timer.Stop()
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	fastResp := cmd.response()
+	fastResp.Reset()
+	fastResp.SetStatusCode(resp.StatusCode)
+	for key, values := range resp.Header {
+		if key == fasthttp.HeaderContentLength || key == fasthttp.HeaderTransferEncoding {
+			continue
+		}
+		for _, val := range values {
+			fastResp.Header.Add(key, val)
+		}
+	}
+
+	var total int64 = -1
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// server doesn't support range, download from start
+		if offset != 0 {
+			if err := part.Truncate(0); err != nil {
+				return err
+			}
+			if _, err := part.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			offset = 0
+		}
+		total = resp.ContentLength
+	case http.StatusPartialContent:
+		start, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || start != offset {
+			part.Truncate(0)
+			return fmt.Errorf("unexpected Content-Range %s", resp.Header.Get("Content-Range"))
+		}
+		total = size
+	case http.StatusRequestedRangeNotSatisfiable:
+		// part file is broken, download from start next time
+		part.Truncate(0)
+		return fmt.Errorf("range of part file %d is not satisfiable", offset)
+	default:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, streamErrorBodyLimit))
+		fastResp.SetBody(body)
+		return nil
+	}
+
+	if opts.maxSize > 0 && total > opts.maxSize {
+		opts.tooLarge = true
+		part.Close()
+		os.Remove(partPath)
+		return nil
+	}
+
+	var body io.Reader = resp.Body
+	if opts.maxSize > 0 {
+		body = io.LimitReader(body, opts.maxSize-offset+1)
+	}
+	reader := newIdleReader(body, cmd.timeout(), cancel)
+	written, err := io.Copy(part, reader)
+	reader.stop()
+	cmd.task.recordDownloadedBytes(int(written), int(written))
+	if err != nil {
+		// part file is resumed by retry
+		return err
+	}
+
+	size := offset + written
+	if opts.maxSize > 0 && size > opts.maxSize {
+		opts.tooLarge = true
+		part.Close()
+		os.Remove(partPath)
+		return nil
+	}
+	if total >= 0 && size != total {
+		return downloadErrContentLength
+	}
+
+	if err := verifyChecksum(part, opts); err != nil {
+		part.Truncate(0)
+		return err
+	}
+	if err := part.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, filePath); err != nil {
+		return err
+	}
+
+	// body is in file, response looks like a complete 200 response
+	fastResp.SetStatusCode(http.StatusOK)
+	fastResp.Header.Del(fasthttp.HeaderContentRange)
+	fastResp.Header.Del(fasthttp.HeaderContentEncoding)
+	logrus.WithFields(cmd.logrusFields()).WithFields(logrus.Fields{
+		"FilePath": filePath,
+		"Size":     size,
+	}).Info("stream download finished")
+	return nil
+}
+
+func newStreamRequest(ctx context.Context, cmd *command, offset int64) (*http.Request, error) {
+	fastReq := cmd.request()
+	req, err := http.NewRequestWithContext(
+		ctx,
+		string(fastReq.Header.Method()),
+		fastReq.URI().String(),
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	fastReq.Header.VisitAll(func(key, value []byte) {
+		req.Header.Add(string(key), string(value))
+	})
+	// body is saved as it is
+	req.Header.Del(fasthttp.HeaderAcceptEncoding)
+	req.Header.Del(fasthttp.HeaderHost)
+	if offset > 0 {
+		req.Header.Set(fasthttp.HeaderRange, fmt.Sprintf("bytes=%d-", offset))
+	}
+	return req, nil
+}
+
+// bytes [start]-[end]/[size], size is -1 if it is *
+func parseContentRange(val string) (int64, int64, bool) {
+	val = strings.TrimSpace(val)
+	if !strings.HasPrefix(val, "bytes ") {
+		return 0, 0, false
+	}
+	val = strings.TrimPrefix(val, "bytes ")
+	slash := strings.Index(val, "/")
+	dash := strings.Index(val, "-")
+	if slash == -1 || dash == -1 || dash > slash {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(val[:dash], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if val[slash+1:] == "*" {
+		return start, -1, true
+	}
+	size, err := strconv.ParseInt(val[slash+1:], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+func verifyChecksum(file *os.File, opts *streamOptions) error {
+	h, err := opts.newHash()
+	if err != nil || h == nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), opts.checksum) {
+		return downloadErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package cobweb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	task := newTaskFromRule(&frontierTestRule{}, NewMemoryFrontier())
+	defer os.Remove(path.Dir(task.folderPath()))
+	defer os.RemoveAll(task.folderPath())
+	client := newStreamClient(nil)
+	newStreamCommand := func(fileName string) *command {
+		b := newCommandBuilder(task)
+		b.Link(server.URL + "/file.bin")
+		b.Checksum("sha256", hex.EncodeToString(sum[:]))
+		b.streamTo(fileName)
+		return b.build()
+	}
+
+	// resume from part file
+	filePath := path.Join(task.folderPath(), "a", "file.bin")
+	assert.Nil(t, os.MkdirAll(path.Dir(filePath), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filePath+".part", content[:4000], os.ModePerm))
+	cmd := newStreamCommand("a/file.bin")
+	assert.Nil(t, streamDownload(client, cmd))
+	assert.Equal(t, 200, cmd.response().StatusCode())
+	saved, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, content, saved)
+	_, err = os.Stat(filePath + ".part")
+	assert.True(t, os.IsNotExist(err))
+
+	// checksum mismatch
+	cmd = newStreamCommand("b/file.bin")
+	cmd.stream.checksum = "00"
+	assert.Equal(t, downloadErrChecksumMismatch, streamDownload(client, cmd))
+
+	// too large
+	cmd = newStreamCommand("c/file.bin")
+	cmd.stream.maxSize = 100
+	assert.Nil(t, streamDownload(client, cmd))
+	assert.True(t, cmd.stream.tooLarge)
+	_, err = os.Stat(path.Join(task.folderPath(), "c"))
+	assert.Nil(t, err)
+	_, err = os.Stat(path.Join(task.folderPath(), "c", "file.bin"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, size, ok := parseContentRange("bytes 100-199/1000")
+	assert.True(t, ok)
+	assert.Equal(t, int64(100), start)
+	assert.Equal(t, int64(1000), size)
+
+	_, size, ok = parseContentRange("bytes 0-99/*")
+	assert.True(t, ok)
+	assert.Equal(t, int64(-1), size)
+
+	_, _, ok = parseContentRange("items 0-1/2")
+	assert.False(t, ok)
+}
+
+func TestSaveResourceStream(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://example.com/", "")
+
+	// resource is kept in memory by default, so method and body of request are kept
+	ctx.SaveResource("/a.bin", "a.bin")
+	fBuilder := ctx.NewFollowBuilder()
+	fBuilder.MaxSize(100)
+	ctx.SaveResourceWithBuilder("/b.bin", "b.bin", fBuilder)
+	fBuilder = ctx.NewFollowBuilder()
+	fBuilder.Stream()
+	ctx.SaveResourceWithBuilder("/c.bin", "c.bin", fBuilder)
+
+	cmds := ctx.commands()
+	assert.Len(t, cmds, 3)
+	assert.Nil(t, cmds[0].stream)
+	assert.Equal(t, "b.bin", cmds[1].stream.fileName)
+	assert.Equal(t, int64(100), cmds[1].stream.maxSize)
+	assert.Equal(t, "c.bin", cmds[2].stream.fileName)
+}
@@ -1,11 +1,14 @@
 package cobweb
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
+	"regexp"
+	"runtime"
 	"sync"
 	"time"
 
@@ -63,10 +66,68 @@ type OnPipeErrorRule interface {
 	OnPipeError(info *PipeErrorInfo)
 }
 
+// CallbacksRule lists parse callbacks used by rule
+// commands popped from a shared Frontier find their callback by name,
+// so every callback passed to Follow has to be listed here
+// if the task is run by several executors.
+// callbacks have to be methods or functions, not closures
+type CallbacksRule interface {
+	Callbacks() []OnParseCallback
+}
+
+// stats shared by frontier
+const (
+	TaskStatRunningCMD   = "RunningCMDCnt"
+	TaskStatCompletedCMD = "CompletedCMDCnt"
+	TaskStatFailedCMD    = "FailedCMDCnt"
+	TaskStatDroppedCMD   = "DroppedCMDCnt"
+	TaskStatBannedCMD    = "BannedCMDCnt"
+	// responses served from http cache
+	TaskStatCacheHit = "CacheHitCnt"
+
+	// size of response bodies before and after decompression
+	TaskStatCompressedBytes   = "CompressedBytes"
+	TaskStatUncompressedBytes = "UncompressedBytes"
+
+	TaskStatPipingItem    = "PipeliningItemCnt"
+	TaskStatCompletedItem = "CompletedItemCnt"
+	TaskStatFailedItem    = "FailedItemCnt"
+
+	// items found by ChangeDetectPipeline
+	TaskStatNewItem       = "NewItemCnt"
+	TaskStatUpdatedItem   = "UpdatedItemCnt"
+	TaskStatUnchangedItem = "UnchangedItemCnt"
+)
+
+// callbacks used by cobweb itself
+var builtinCallbacks = []OnParseCallback{
+	saveResourceCallback,
+	saveMediaCallback,
+	sitemapCallback,
+	crawlCallback,
+	declarativeCallback,
+}
+
+func callbackName(callback OnParseCallback) string {
+	if callback == nil {
+		return ""
+	}
+	return runtime.FuncForPC(reflect.ValueOf(callback).Pointer()).Name()
+}
+
+// name of function literal ends with .funcN, e.g. main.main.func1
+var closureNameRegexp = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+func isClosure(callback OnParseCallback) bool {
+	return closureNameRegexp.MatchString(callbackName(callback))
+}
+
 type Task struct {
 	name string
 	id   xid.ID
 	rule BaseRule
+	// first invalid setting of rule, task of it is rejected
+	ruleErr error
 
 	downloadTimeout time.Duration
 	itemPipelines   []Pipeline
@@ -77,15 +138,48 @@ type Task struct {
 
 	cmdFailedCntLimit int
 
+	hostRateLimits map[string]HostRateLimit
+	autoThrottle   *AutoThrottle
+	retryPolicy    *RetryPolicy
+	banDetectors   []BanDetector
+	redirectPolicy RedirectPolicy
+	charset        string
+	httpCache      *httpCache
+
+	mediaConfig     MediaStoreConfig
+	mediaOnce       sync.Once
+	mediaStore      *mediaStore
+	processorConfig *MediaProcessorConfig
+	// mediaProcessor is set by media() and read by finish()
+	processorLocker sync.Mutex
+	mediaProcessor  *mediaProcessor
+
+	cookieJarMode CookieJarMode
+	cookieJar     *cookieJar
+	auth          *taskAuth
+
+	frontier Frontier
+
+	callbackLocker sync.RWMutex
+	callbacks      map[string]OnParseCallback
+
 	cmdCountLocker    sync.Mutex
 	runningCMDCount   int
 	completedCMDCount int
 	failedCMDCount    int
+	droppedCMDCount   int
+	bannedCMDCount    int
+	cacheHitCount     int
+
+	bytesCountLocker  sync.Mutex
+	compressedBytes   int
+	uncompressedBytes int
 
 	itemCountLocker    sync.Mutex
 	pipingItemCount    int
 	completedItemCount int
 	failedItemCount    int
+	itemChangeCounts   map[ItemChange]int
 
 	itemTypeSet mapset.Set
 
@@ -93,23 +187,67 @@ type Task struct {
 	finishChannel chan struct{}
 }
 
-func newTaskFromRule(rule BaseRule) *Task {
+func newTaskFromRule(rule BaseRule, frontier Frontier) *Task {
+	return newTaskWithID(rule, frontier, xid.New())
+}
+
+// task joined by executors sharing frontier has the same id, so does its folder
+// task only has name and ruleErr if rule is invalid
+func newTaskWithID(rule BaseRule, frontier Frontier, id xid.ID) *Task {
 	t := &Task{
-		id:            xid.New(),
-		rule:          rule,
-		itemTypeSet:   mapset.NewSet(),
-		finishChannel: make(chan struct{}),
+		id:               id,
+		rule:             rule,
+		frontier:         frontier,
+		callbacks:        make(map[string]OnParseCallback),
+		itemTypeSet:      mapset.NewSet(),
+		itemChangeCounts: make(map[ItemChange]int),
+		finishChannel:    make(chan struct{}),
 	}
 	t.setName(rule)
+	if err := validateRule(rule); err != nil {
+		t.ruleErr = err
+		return t
+	}
+	t.setCallbacks(rule)
+	t.setCookieJar(rule)
+	t.setAuth(rule)
 	t.setDownloadTimeout(rule)
 	t.setPipelines(rule)
 	t.setCommandFailedCntLimit(rule)
+	t.setHostRateLimits(rule)
+	t.setAutoThrottle(rule)
+	t.setRetryPolicy(rule)
+	t.setBanDetectors(rule)
+	t.setRedirectPolicy(rule)
+	t.setCharset(rule)
+	t.setHTTPCache(rule)
+	t.setMediaStore(rule)
 	t.setParseErrorCallback(rule)
 	t.setPipeErrorCallback(rule)
 	t.setDownloadFinishCallback(rule)
 	return t
 }
 
+// invalid settings of rule, it's checked without creating task
+func validateRule(rule BaseRule) error {
+	if _, ok := rule.(AuthRule); ok {
+		if jarRule, ok := rule.(CookieJarRule); ok && jarRule.CookieJarMode() == CookieJarDisabled {
+			return errors.New("AuthRule can't be used with CookieJarDisabled")
+		}
+	}
+	if holder, ok := rule.(crawlRuleHolder); ok {
+		if err := holder.crawlRule().compile(); err != nil {
+			return err
+		}
+	}
+	if holder, ok := rule.(declarativeRuleHolder); ok {
+		if err := holder.declarativeRule().compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (t *Task) setPipelines(rule BaseRule) {
 	pipeRule, ok := rule.(PipelineRule)
 	if ok {
@@ -122,19 +260,23 @@ func (t *Task) setPipelines(rule BaseRule) {
 }
 
 func (t *Task) setName(rule BaseRule) {
+	t.name = ruleName(rule)
+}
+
+// TaskName of rule, name of rule's type if it doesn't have one
+func ruleName(rule BaseRule) string {
 	nameRule, ok := rule.(TaskNameRule)
 	if ok {
-		t.name = nameRule.TaskName()
-	} else {
-		ruleVal := reflect.ValueOf(rule)
-		if ruleVal.Kind() == reflect.Ptr {
-			ruleVal = ruleVal.Elem()
-		}
-		if ruleVal.Kind() != reflect.Struct {
-			panic("rule has to be a struct")
-		}
-		t.name = ruleVal.Type().Name()
+		return nameRule.TaskName()
+	}
+	ruleVal := reflect.ValueOf(rule)
+	if ruleVal.Kind() == reflect.Ptr {
+		ruleVal = ruleVal.Elem()
 	}
+	if ruleVal.Kind() != reflect.Struct {
+		panic("rule has to be a struct")
+	}
+	return ruleVal.Type().Name()
 }
 
 func (t *Task) setCommandFailedCntLimit(rule BaseRule) {
@@ -146,6 +288,187 @@ func (t *Task) setCommandFailedCntLimit(rule BaseRule) {
 	}
 }
 
+func (t *Task) setHostRateLimits(rule BaseRule) {
+	limitRule, ok := rule.(HostRateLimitRule)
+	if ok {
+		t.hostRateLimits = limitRule.HostRateLimits()
+	}
+}
+
+func (t *Task) setAutoThrottle(rule BaseRule) {
+	throttleRule, ok := rule.(AutoThrottleRule)
+	if !ok {
+		return
+	}
+
+	conf := throttleRule.AutoThrottle()
+	if conf.StartDelay == 0 {
+		conf.StartDelay = DefaultAutoThrottle.StartDelay
+	}
+	if conf.MaxDelay == 0 {
+		conf.MaxDelay = DefaultAutoThrottle.MaxDelay
+	}
+	if conf.TargetConcurrency <= 0 {
+		conf.TargetConcurrency = DefaultAutoThrottle.TargetConcurrency
+	}
+	t.autoThrottle = &conf
+}
+
+func (t *Task) setRetryPolicy(rule BaseRule) {
+	// responses are never retried by status without RetryPolicyRule
+	policyRule, ok := rule.(RetryPolicyRule)
+	if !ok {
+		return
+	}
+	policy := policyRule.RetryPolicy()
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultRetryPolicy.MaxAttempts
+	}
+	t.retryPolicy = &policy
+}
+
+func (t *Task) setBanDetectors(rule BaseRule) {
+	detectorsRule, ok := rule.(BanDetectorsRule)
+	if ok {
+		t.banDetectors = detectorsRule.BanDetectors()
+	}
+}
+
+func (t *Task) setRedirectPolicy(rule BaseRule) {
+	policyRule, ok := rule.(RedirectPolicyRule)
+	if ok {
+		t.redirectPolicy = policyRule.RedirectPolicy()
+	} else {
+		t.redirectPolicy = DefaultRedirectPolicy
+	}
+}
+
+func (t *Task) setCharset(rule BaseRule) {
+	charsetRule, ok := rule.(CharsetRule)
+	if ok {
+		t.charset = charsetRule.Charset()
+	}
+}
+
+func (t *Task) setHTTPCache(rule BaseRule) {
+	cacheRule, ok := rule.(HTTPCacheRule)
+	if !ok {
+		return
+	}
+	conf := cacheRule.HTTPCache()
+	if conf.Policy == CachePolicyNever {
+		return
+	}
+	if conf.Dir == "" {
+		// task folder changes every run
+		conf.Dir = path.Join("instance", "httpcache", t.Name())
+	}
+	t.httpCache = newHTTPCache(conf.Policy, conf.Dir)
+}
+
+func (t *Task) setMediaStore(rule BaseRule) {
+	storeRule, ok := rule.(MediaStoreRule)
+	if ok {
+		t.mediaConfig = storeRule.MediaStore()
+	} else {
+		t.mediaConfig = DefaultMediaStoreConfig
+	}
+
+	processorRule, ok := rule.(MediaProcessorRule)
+	if ok {
+		conf := processorRule.MediaProcessor()
+		t.processorConfig = &conf
+	}
+}
+
+// media saved by SaveMedia is processed if task has MediaProcessorRule
+func (t *Task) processMedia(ref MediaRef) {
+	t.media()
+	if processor := t.processor(); processor != nil && ref.Path != "" {
+		processor.process(ref)
+	}
+}
+
+// media processor of task, nil if media store isn't used or task has no MediaProcessorRule
+func (t *Task) processor() *mediaProcessor {
+	t.processorLocker.Lock()
+	defer t.processorLocker.Unlock()
+	return t.mediaProcessor
+}
+
+// media store is loaded when it is used the first time
+func (t *Task) media() *mediaStore {
+	t.mediaOnce.Do(func() {
+		t.mediaStore = newMediaStore(path.Join(t.folderPath(), t.mediaDir()), t.mediaConfig.Symlinks)
+		if t.processorConfig != nil {
+			t.processorLocker.Lock()
+			t.mediaProcessor = newMediaProcessor(*t.processorConfig, t.mediaStore)
+			t.processorLocker.Unlock()
+		}
+	})
+	return t.mediaStore
+}
+
+// dir of media store relative to task folder
+func (t *Task) mediaDir() string {
+	if t.mediaConfig.Dir == "" {
+		return DefaultMediaStoreConfig.Dir
+	}
+	return t.mediaConfig.Dir
+}
+
+// return reason of ban, or empty string if response of cmd is fine
+func (t *Task) detectBan(cmd *command) string {
+	for _, detector := range t.banDetectors {
+		if reason := detector.DetectBan(cmd.request(), cmd.response()); reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
+
+func (t *Task) setCookieJar(rule BaseRule) {
+	jarRule, ok := rule.(CookieJarRule)
+	if ok {
+		t.cookieJarMode = jarRule.CookieJarMode()
+	} else {
+		t.cookieJarMode = CookieJarDisabled
+	}
+	if t.cookieJarMode != CookieJarDisabled {
+		// task folder changes every run, session is reloaded by task name
+		t.cookieJar = newCookieJar(path.Join("instance", "cookies", t.Name()+".json"))
+	}
+}
+
+// key of cookie jar used by commands downloaded by proxy
+func (t *Task) cookieJarKey(proxy *Proxy) string {
+	if t.cookieJarMode == CookieJarPerProxy && proxy != nil {
+		return proxy.GetProxyURL()
+	}
+	return ""
+}
+
+func (t *Task) setAuth(rule BaseRule) {
+	authRule, ok := rule.(AuthRule)
+	if !ok {
+		return
+	}
+	if t.cookieJar == nil {
+		// login cookies are kept in memory
+		t.cookieJarMode = CookieJarPerTask
+		t.cookieJar = newCookieJar("")
+	}
+	t.auth = newTaskAuth(t, authRule)
+}
+
+// run AuthRule of task if session doesn't exist
+func (t *Task) authenticate() error {
+	if t.auth == nil {
+		return nil
+	}
+	return t.auth.ensure()
+}
+
 func (t *Task) setDownloadTimeout(rule BaseRule) {
 	timeoutRule, ok := rule.(DownloadTimeoutRule)
 	if ok {
@@ -155,6 +478,47 @@ func (t *Task) setDownloadTimeout(rule BaseRule) {
 	}
 }
 
+func (t *Task) setCallbacks(rule BaseRule) {
+	t.registerCallback(rule.InitParse)
+	for _, callback := range builtinCallbacks {
+		t.registerCallback(callback)
+	}
+	sitemapRule, ok := rule.(SitemapRule)
+	if ok {
+		t.registerCallback(sitemapRule.SitemapParse)
+	}
+	callbacksRule, ok := rule.(CallbacksRule)
+	if ok {
+		for _, callback := range callbacksRule.Callbacks() {
+			t.registerCallback(callback)
+		}
+	}
+}
+
+// remember callback and return its name
+func (t *Task) registerCallback(callback OnParseCallback) string {
+	name := callbackName(callback)
+	if name == "" {
+		return name
+	}
+
+	t.callbackLocker.Lock()
+	defer t.callbackLocker.Unlock()
+	if t.callbacks == nil {
+		t.callbacks = make(map[string]OnParseCallback)
+	}
+	if _, ok := t.callbacks[name]; !ok {
+		t.callbacks[name] = callback
+	}
+	return name
+}
+
+func (t *Task) callbackByName(name string) OnParseCallback {
+	t.callbackLocker.RLock()
+	defer t.callbackLocker.RUnlock()
+	return t.callbacks[name]
+}
+
 // onParseErrorCallback
 func (t *Task) setParseErrorCallback(rule BaseRule) {
 	callbackRule, ok := rule.(OnParseErrorRule)
@@ -196,6 +560,19 @@ func (t *Task) initCommands() []*command {
 		cmd := builder.build()
 		cmds = append(cmds, cmd)
 	}
+
+	sitemapRule, ok := t.rule.(SitemapRule)
+	if ok {
+		data := sitemapData(t.registerCallback(sitemapRule.SitemapParse), sitemapRule.SitemapFilter())
+		for _, link := range sitemapRule.Sitemaps() {
+			builder := newCommandBuilder(t)
+			builder.Link(link)
+			builder.Callback(sitemapCallback)
+			builder.DownloadTimeout(t.downloadTimeout)
+			builder.ContextData(data)
+			cmds = append(cmds, builder.build())
+		}
+	}
 	t.recordNewCommands(cmds)
 	return cmds
 }
@@ -206,6 +583,12 @@ func (t *Task) Wait() {
 
 func (t *Task) finish() {
 	t.finishOnce.Do(func() {
+		if processor := t.processor(); processor != nil {
+			processor.stop()
+		}
+		if t.cookieJar != nil {
+			t.cookieJar.flush()
+		}
 		for _, pipeline := range t.itemPipelines {
 			pipeline.Close()
 		}
@@ -221,6 +604,25 @@ func (t *Task) ID() string {
 	return t.id.String()
 }
 
+// stats of task shared by every executor running it
+func (t *Task) Stats() (map[string]int64, error) {
+	return t.frontier.Stats(t.ID())
+}
+
+// add delta to stat shared by frontier
+// localVal is returned if frontier fails
+func (t *Task) incrStat(key string, delta int, localVal int) int {
+	val, err := t.frontier.IncrStat(t.ID(), key, int64(delta))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"Error":   err,
+			"StatKey": key,
+		}).WithFields(t.logrusFields()).Error("incr task stat failed")
+		return localVal
+	}
+	return int(val)
+}
+
 func (t *Task) logrusFields() logrus.Fields {
 	return logrus.Fields{
 		"TaskName":          t.Name(),
@@ -228,6 +630,8 @@ func (t *Task) logrusFields() logrus.Fields {
 		"RunningCMDCnt":     t.runningCMDCount,
 		"CompletedCMDCnt":   t.completedCMDCount,
 		"FailedCMDCnt":      t.failedCMDCount,
+		"DroppedCMDCnt":     t.droppedCMDCount,
+		"BannedCMDCnt":      t.bannedCMDCount,
 		"PipeliningItemCnt": t.pipingItemCount,
 		"CompletedItemCnt":  t.completedItemCount,
 		"FailedItemCnt":     t.failedItemCount,
@@ -235,67 +639,139 @@ func (t *Task) logrusFields() logrus.Fields {
 }
 
 func (t *Task) recordNewCommands(cmds []*command) {
+	if len(cmds) == 0 {
+		return
+	}
 	t.cmdCountLocker.Lock()
 	defer t.cmdCountLocker.Unlock()
 	t.runningCMDCount += len(cmds)
+	t.incrStat(TaskStatRunningCMD, len(cmds), t.runningCMDCount)
 }
 
 func (t *Task) recordCompletedCommand(cmd *command) {
+	cmd.ack()
+
 	t.cmdCountLocker.Lock()
-	defer t.cmdCountLocker.Unlock()
 	t.runningCMDCount--
 	t.completedCMDCount++
+	t.incrStat(TaskStatRunningCMD, -1, t.runningCMDCount)
+	t.incrStat(TaskStatCompletedCMD, 1, t.completedCMDCount)
+	t.cmdCountLocker.Unlock()
 
-	t.itemCountLocker.Lock()
-	defer t.itemCountLocker.Unlock()
-	if t.runningCMDCount == 0 && t.pipingItemCount == 0 {
-		t.finish()
-	}
+	t.checkFinish()
 }
 
 func (t *Task) recordFailedCommand(cmd *command) {
+	cmd.ack()
+
 	t.cmdCountLocker.Lock()
-	defer t.cmdCountLocker.Unlock()
 	t.runningCMDCount--
 	t.failedCMDCount++
+	t.incrStat(TaskStatRunningCMD, -1, t.runningCMDCount)
+	t.incrStat(TaskStatFailedCMD, 1, t.failedCMDCount)
+	t.cmdCountLocker.Unlock()
 
 	logrus.WithFields(cmd.logrusFields()).Warn("failed command")
+	t.checkFinish()
+}
 
-	t.itemCountLocker.Lock()
-	defer t.itemCountLocker.Unlock()
-	if t.runningCMDCount == 0 && t.pipingItemCount == 0 {
-		t.finish()
-	}
+// command is dropped by dedup set
+func (t *Task) recordDroppedCommand(cmd *command) {
+	t.cmdCountLocker.Lock()
+	t.runningCMDCount--
+	t.droppedCMDCount++
+	t.incrStat(TaskStatRunningCMD, -1, t.runningCMDCount)
+	t.incrStat(TaskStatDroppedCMD, 1, t.droppedCMDCount)
+	t.cmdCountLocker.Unlock()
+
+	t.checkFinish()
+}
+
+// response of command is banned, command is still running
+func (t *Task) recordBannedCommand(cmd *command, reason string) {
+	t.cmdCountLocker.Lock()
+	t.bannedCMDCount++
+	t.incrStat(TaskStatBannedCMD, 1, t.bannedCMDCount)
+	t.cmdCountLocker.Unlock()
+
+	logrus.WithFields(cmd.logrusFields()).WithField("BanReason", reason).Warn("banned command")
+}
+
+func (t *Task) recordCacheHit(cmd *command) {
+	t.cmdCountLocker.Lock()
+	t.cacheHitCount++
+	t.incrStat(TaskStatCacheHit, 1, t.cacheHitCount)
+	t.cmdCountLocker.Unlock()
+
+	logrus.WithFields(cmd.logrusFields()).WithField("Revalidated", cmd.cacheRevalidated).Debug("response served from http cache")
+}
+
+func (t *Task) recordDownloadedBytes(compressedLen, uncompressedLen int) {
+	t.bytesCountLocker.Lock()
+	defer t.bytesCountLocker.Unlock()
+	t.compressedBytes += compressedLen
+	t.uncompressedBytes += uncompressedLen
+	t.incrStat(TaskStatCompressedBytes, compressedLen, t.compressedBytes)
+	t.incrStat(TaskStatUncompressedBytes, uncompressedLen, t.uncompressedBytes)
 }
 
 func (t *Task) recordNewItemInfos(infos []*itemInfo) {
+	if len(infos) == 0 {
+		return
+	}
 	t.itemCountLocker.Lock()
 	defer t.itemCountLocker.Unlock()
 	t.pipingItemCount += len(infos)
+	t.incrStat(TaskStatPipingItem, len(infos), t.pipingItemCount)
 }
 
 func (t *Task) recordCompletedItemInfo(info *itemInfo) {
 	t.itemCountLocker.Lock()
-	defer t.itemCountLocker.Unlock()
 	t.pipingItemCount--
 	t.completedItemCount++
+	t.incrStat(TaskStatPipingItem, -1, t.pipingItemCount)
+	t.incrStat(TaskStatCompletedItem, 1, t.completedItemCount)
+	t.itemCountLocker.Unlock()
 
-	t.cmdCountLocker.Lock()
-	defer t.cmdCountLocker.Unlock()
-	if t.runningCMDCount == 0 && t.pipingItemCount == 0 {
-		t.finish()
-	}
+	t.checkFinish()
 }
 
 func (t *Task) recordFailedItemInfo(info *itemInfo) {
 	t.itemCountLocker.Lock()
-	defer t.itemCountLocker.Unlock()
 	t.pipingItemCount--
 	t.failedItemCount++
+	t.incrStat(TaskStatPipingItem, -1, t.pipingItemCount)
+	t.incrStat(TaskStatFailedItem, 1, t.failedItemCount)
+	t.itemCountLocker.Unlock()
+
+	t.checkFinish()
+}
+
+var itemChangeStats = map[ItemChange]string{
+	ItemNew:       TaskStatNewItem,
+	ItemUpdated:   TaskStatUpdatedItem,
+	ItemUnchanged: TaskStatUnchangedItem,
+}
+
+func (t *Task) recordItemChange(change ItemChange) {
+	t.itemCountLocker.Lock()
+	defer t.itemCountLocker.Unlock()
+	t.itemChangeCounts[change]++
+	t.incrStat(itemChangeStats[change], 1, t.itemChangeCounts[change])
+}
 
+// finish task if no command is running and no item is piping
+// in every executor sharing the frontier
+func (t *Task) checkFinish() {
 	t.cmdCountLocker.Lock()
-	defer t.cmdCountLocker.Unlock()
-	if t.runningCMDCount == 0 && t.pipingItemCount == 0 {
+	running := t.incrStat(TaskStatRunningCMD, 0, t.runningCMDCount)
+	t.cmdCountLocker.Unlock()
+
+	t.itemCountLocker.Lock()
+	piping := t.incrStat(TaskStatPipingItem, 0, t.pipingItemCount)
+	t.itemCountLocker.Unlock()
+
+	if running == 0 && piping == 0 {
 		t.finish()
 	}
 }
@@ -322,6 +798,8 @@ func (t *Task) pipelines() []Pipeline {
 //  UnknownParseError ParseErrorKind = iota
 //	ParseHTMLError
 //	HTMLNodeNotFoundError
+//	ParseFeedError
+//	ParseJSONError
 func (t *Task) defaultParseErrorCallback(info *ParseErrorInfo) {
 	switch info.ErrKind {
 	case ParseHTMLError:
@@ -330,6 +808,12 @@ func (t *Task) defaultParseErrorCallback(info *ParseErrorInfo) {
 	case HTMLNodeNotFoundError:
 		info.Ctx.Retry()
 
+	case ParseFeedError:
+		info.Ctx.Retry()
+
+	case ParseJSONError:
+		info.Ctx.Retry()
+
 	case UnknownParseError:
 		t.recordFailedCommand(info.Ctx.cmd)
 
@@ -348,6 +832,12 @@ func (t *Task) debugParseErrorCallback(info *ParseErrorInfo) {
 	case HTMLNodeNotFoundError:
 		info.Ctx.Retry()
 
+	case ParseFeedError:
+		info.Ctx.Retry()
+
+	case ParseJSONError:
+		info.Ctx.Retry()
+
 	case UnknownParseError:
 		t.recordFailedCommand(info.Ctx.cmd)
 
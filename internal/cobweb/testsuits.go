@@ -46,6 +46,27 @@ func (suit *testSuits) WithFile(callback OnParseCallback, filename string, conte
 	return suit.WithBytes(callback, b, contextData)
 }
 
+// rule of task of contexts created by ContextWithString
+type testSuitsRule struct{}
+
+func (r *testSuitsRule) InitLinks() []string {
+	return []string{"http://example.com/"}
+}
+
+func (r *testSuitsRule) InitParse(ctx *Context) {
+}
+
+// context of body downloaded from link by a new task, its callback is InitParse of task's rule
+func (suit *testSuits) ContextWithString(link string, body string) *Context {
+	task := newTaskFromRule(&testSuitsRule{}, NewMemoryFrontier())
+	b := newCommandBuilder(task)
+	b.Link(link)
+	b.Callback(task.rule.InitParse)
+	cmd := b.build()
+	cmd.response().SetBodyString(body)
+	return newContext(cmd)
+}
+
 func (suit *testSuits) WithBytes(callback OnParseCallback, data []byte, contextData H) ([]string, []interface{}) {
 	cmd := &command{
 		id: xid.New(),
@@ -53,6 +74,8 @@ func (suit *testSuits) WithBytes(callback OnParseCallback, data []byte, contextD
 			name:        "TestSuit",
 			id:          xid.New(),
 			itemTypeSet: mapset.NewSet(),
+			frontier:    NewMemoryFrontier(),
+			callbacks:   make(map[string]OnParseCallback),
 		},
 		contextData: contextData,
 	}
@@ -91,6 +114,10 @@ func (suit *testSuits) handlePanicInfo(info *ParseErrorInfo) {
 		suit.t.Errorf(string(info.jsonRep()))
 	case HTMLNodeNotFoundError:
 		suit.t.Errorf(string(info.jsonRep()))
+	case ParseFeedError:
+		suit.t.Errorf(string(info.jsonRep()))
+	case ParseJSONError:
+		suit.t.Errorf(string(info.jsonRep()))
 	case UnknownParseError:
 		suit.t.Errorf(string(info.jsonRep()))
 	}
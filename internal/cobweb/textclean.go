@@ -0,0 +1,197 @@
+package cobweb
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/width"
+)
+
+// layouts tried by HTMLElement.Time if none is given
+var DefaultTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"2006.01.02",
+	"2006年01月02日 15:04",
+	"2006年01月02日",
+	"2006年1月2日",
+	time.RFC3339,
+}
+
+var (
+	// 1,234.5 -3 +0.5
+	numberRegexp = regexp.MustCompile(`[-+]?(?:\d[\d,]*(?:\.\d+)?|\.\d+)`)
+	// chinese units after numbers, e.g. 2107 万热度
+	numberUnits = map[string]float64{
+		"万": 1e4,
+		"亿": 1e8,
+	}
+	zeroWidthReplacer = strings.NewReplacer("\u200b", "", "\u200c", "", "\u200d", "", "\ufeff", "")
+)
+
+// zero width characters removed,
+// whitespace including NBSP and full-width space collapsed to a single space and trimmed
+// entities of text of document are decoded by parser already, they are kept
+func normalizeText(s string) string {
+	s = zeroWidthReplacer.Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// CleanString cleans raw html string not from document, e.g. matched by Context.Regex,
+// entities are decoded before it is normalized like HTMLElement.CleanText
+func CleanString(s string) string {
+	return normalizeText(html.UnescapeString(s))
+}
+
+// normalized text with full-width letters, digits and punctuations converted to half-width
+func halfWidthText(s string) string {
+	return normalizeText(width.Narrow.String(s))
+}
+
+// the first number of text, thousands separators are ignored
+func parseNumber(s string) (float64, bool) {
+	s = halfWidthText(s)
+	loc := numberRegexp.FindStringIndex(s)
+	if loc == nil {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(strings.ReplaceAll(s[loc[0]:loc[1]], ",", ""), 64)
+	if err != nil {
+		return 0, false
+	}
+	for unit, multiplier := range numberUnits {
+		if strings.HasPrefix(strings.TrimSpace(s[loc[1]:]), unit) {
+			number *= multiplier
+			break
+		}
+	}
+	return number, true
+}
+
+func parseTime(s string, layouts []string) (time.Time, bool) {
+	s = halfWidthText(s)
+	if len(layouts) == 0 {
+		layouts = DefaultTimeLayouts
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// text with whitespace collapsed, NBSP and zero width characters handled
+func (e *HTMLElement) CleanText() string {
+	return normalizeText(e.Text())
+}
+
+// CleanText with full-width characters converted to half-width, e.g. ＡＢＣ１２３ -> ABC123
+func (e *HTMLElement) HalfWidthText() string {
+	return halfWidthText(e.Text())
+}
+
+func (e *HTMLElement) ChildCleanText(selector string) string {
+	return normalizeText(e.ChildText(selector))
+}
+
+func (e *HTMLElement) MayChildCleanText(selector string) string {
+	return normalizeText(e.MayChildText(selector))
+}
+
+func (e *HTMLElement) ChildrenCleanTexts(selector string) []string {
+	return normalizeTexts(e.ChildrenTexts(selector))
+}
+
+func (e *HTMLElement) MayChildrenCleanTexts(selector string) []string {
+	return normalizeTexts(e.MayChildrenTexts(selector))
+}
+
+func normalizeTexts(texts []string) []string {
+	for i := range texts {
+		texts[i] = normalizeText(texts[i])
+	}
+	return texts
+}
+
+// the first number in text, e.g. "￥1,299.00" -> 1299, "2107 万热度" -> 21070000
+// panic with HTMLNodeNotFoundError if text doesn't have a number
+func (e *HTMLElement) Number() float64 {
+	number, ok := e.MayNumber()
+	if !ok {
+		e.ctx.panicByHTMLNotFound(e.selectRules.append("number", e.CleanText()))
+	}
+	return number
+}
+
+func (e *HTMLElement) MayNumber() (float64, bool) {
+	return parseNumber(e.Text())
+}
+
+// Number without fraction
+func (e *HTMLElement) Int() int {
+	return int(e.Number())
+}
+
+func (e *HTMLElement) MayInt() (int, bool) {
+	number, ok := e.MayNumber()
+	return int(number), ok
+}
+
+// text parsed in local time by the first matched layout, DefaultTimeLayouts if layouts are empty
+// panic with HTMLNodeNotFoundError if no layout matches
+func (e *HTMLElement) Time(layouts ...string) time.Time {
+	t, ok := e.MayTime(layouts...)
+	if !ok {
+		rules := e.selectRules.append("time", e.CleanText())
+		for _, layout := range layouts {
+			rules.append("layout", layout)
+		}
+		e.ctx.panicByHTMLNotFound(rules)
+	}
+	return t
+}
+
+func (e *HTMLElement) MayTime(layouts ...string) (time.Time, bool) {
+	return parseTime(e.Text(), layouts)
+}
+
+// attribute like href or src resolved against url of response or <base href>
+// panic with HTMLNodeNotFoundError if element doesn't have it
+func (e *HTMLElement) AbsAttr(key string) string {
+	link := e.Attr(key)
+	return e.absURL(link)
+}
+
+// empty if element doesn't have attribute
+func (e *HTMLElement) MayAbsAttr(key string) string {
+	link, ok := e.mayAttr(key)
+	if !ok {
+		return ""
+	}
+	return e.absURL(link)
+}
+
+func (e *HTMLElement) ChildAbsAttr(selector, key string) string {
+	return e.absURL(e.ChildAttr(selector, key))
+}
+
+func (e *HTMLElement) MayChildAbsAttr(selector, key string) string {
+	childSelection := e.selection.Find(selector).First()
+	link, ok := childSelection.Attr(key)
+	if !ok {
+		return ""
+	}
+	return e.absURL(link)
+}
+
+// <base href> of document takes precedence over url of response
+func (e *HTMLElement) absURL(link string) string {
+	return e.ctx.absURL(link)
+}
@@ -0,0 +1,91 @@
+package cobweb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextClean(t *testing.T) {
+	// entities of document are decoded once
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/", "<p>\n  a&nbsp; b\u3000\u200bc\t&amp;lt; </p>")
+	ctx.HTML("p", func(element *HTMLElement) {
+		assert.Equal(t, "a b c &lt;", element.CleanText())
+	})
+	assert.Equal(t, "a b &", CleanString("\n  a&nbsp; b\u200b\t&amp; "))
+	assert.Equal(t, "ABC 123,(x)", halfWidthText("ＡＢＣ　１２３，（ｘ）"))
+
+	for text, expected := range map[string]float64{
+		"￥1,299.00": 1299,
+		"2107 万热度":  21070000,
+		"-3.5℃":     -3.5,
+		"共 .5 页":    0.5,
+		"评分：９．２":    9.2,
+	} {
+		number, ok := parseNumber(text)
+		assert.True(t, ok, text)
+		assert.Equal(t, expected, number, text)
+	}
+	_, ok := parseNumber("none")
+	assert.False(t, ok)
+
+	date, ok := parseTime(" 2020年7月29日 ", nil)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2020, 7, 29, 0, 0, 0, 0, time.Local), date)
+	_, ok = parseTime("29/07/2020", nil)
+	assert.False(t, ok)
+	_, ok = parseTime("29/07/2020", []string{"02/01/2006"})
+	assert.True(t, ok)
+}
+
+func TestHTMLElementTextHelpers(t *testing.T) {
+	ctx := NewTestSuits(t).ContextWithString("http://a.com/list/1", `<html><body>
+<div class="item">
+	<h2>  Title&nbsp;&nbsp;One </h2>
+	<span class="price">￥1,299.00</span>
+	<span class="date">2020-07-29</span>
+	<a href="../detail/1"><img src="/img/1.jpg"></a>
+	<table><tr><td> 1.1.1.1 </td><td>
+	80</td></tr></table>
+</div>
+</body></html>`)
+
+	ctx.HTML("div.item", func(element *HTMLElement) {
+		assert.Equal(t, "Title One", element.ChildCleanText("h2"))
+		assert.Equal(t, []string{"1.1.1.1", "80"}, element.ChildrenCleanTexts("td"))
+		assert.Equal(t, "http://a.com/detail/1", element.ChildAbsAttr("a", "href"))
+		assert.Equal(t, "http://a.com/img/1.jpg", element.MayChildAbsAttr("img", "src"))
+		assert.Equal(t, "", element.MayChildAbsAttr("img", "data-src"))
+		assert.Equal(t, "", element.MayAbsAttr("href"))
+		element.ForEach("span.price", func(element *HTMLElement) {
+			assert.Equal(t, 1299.0, element.Number())
+			assert.Equal(t, 1299, element.Int())
+		})
+		element.ForEach("span.date", func(element *HTMLElement) {
+			assert.Equal(t, 2020, element.Time().Year())
+		})
+		element.ForEach("h2", func(element *HTMLElement) {
+			_, ok := element.MayNumber()
+			assert.False(t, ok)
+			defer func() {
+				info := recover().(*ParseErrorInfo)
+				assert.Equal(t, HTMLNodeNotFoundError, info.ErrKind)
+			}()
+			element.Time("2006")
+		})
+	})
+
+	// <base href> takes precedence over url of response
+	ctx = NewTestSuits(t).ContextWithString("http://a.com/list/1", `<html><head><base href="http://cdn.a.com/static/"></head><body><a href="x.png"></a></body></html>`)
+	ctx.HTML("a", func(element *HTMLElement) {
+		assert.Equal(t, "http://cdn.a.com/static/x.png", element.AbsAttr("href"))
+	})
+	ctx.Follow("y.html", ctx.cmd.task.rule.InitParse)
+	assert.Equal(t, "http://cdn.a.com/static/y.html", ctx.commands()[0].request().URI().String())
+	// body which isn't html isn't parsed for <base href>
+	ctx = NewTestSuits(t).ContextWithString("http://a.com/list/1", `<base href="http://cdn.a.com/static/">`)
+	ctx.cmd.response().Header.SetContentType("application/xml")
+	assert.Equal(t, "http://a.com/list/y.html", ctx.absURL("y.html"))
+	assert.Nil(t, ctx.doc)
+}